@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/internal/gitrepo"
 	"bitbucket-secrets-scanner/internal/output"
 	"bitbucket-secrets-scanner/internal/scanner"
+	"bitbucket-secrets-scanner/internal/webhook"
 )
 
 func main() {
 	var (
 		baseURL       string
+		hostType      string
 		httpToken     string
 		projectKey    string
 		repoSlug      string
@@ -21,18 +32,89 @@ func main() {
 		localFilePath string
 		localDirPath  string
 		outputFile    string
+		scanAll       bool
+		scanHistory   bool
+		pullRequestID int
+		scanAllRefs   bool
+		retryPolicy   = bitbucket.DefaultRetryPolicy
+
+		username       string
+		password       string
+		tokenEnv       string
+		tokenFile      string
+		caBundle       string
+		clientCert     string
+		clientKey      string
+		proxyURL       string
+		timeout        time.Duration
+		connectTimeout time.Duration
+		scanTimeout    time.Duration
+		maxFileSize    int64
+		skippedOutput  string
+		suppressedOut  string
+		cloneRepo      bool
+		gitURL         string
+		insightsReport string
+		buildStatus    string
+		buildThreshold float64
+		buildURL       string
+		serveAddr      string
+		blame          bool
+		cacheDir       string
+		rulesFile      string
+		gitleaksConfig string
+		webhookSecret  string
+		workers        int
 	)
 
 	// Define command line flags
 	flag.StringVar(&baseURL, "url", "", "Bitbucket Data Center base URL (e.g., https://bitbucket.example.com)")
+	flag.StringVar(&hostType, "host", "datacenter", "Bitbucket flavour: datacenter or cloud (for cloud, --project is the workspace and --url defaults to "+bitbucket.DefaultCloudURL+")")
 	flag.StringVar(&httpToken, "token", "", "Bitbucket HTTP token")
 	flag.StringVar(&projectKey, "project", "", "Bitbucket project key")
 	flag.StringVar(&repoSlug, "repo", "", "Bitbucket repository slug")
-	flag.StringVar(&commitID, "commit", "", "Bitbucket commit ID")
+	flag.StringVar(&commitID, "commit", "", "Commit to scan: a commit ID, branch or tag name, HEAD for the default branch, or an A..B range")
 	flag.StringVar(&filePath, "file", "", "Bitbucket file path to scan")
 	flag.StringVar(&localFilePath, "local-file", "", "Local file to scan")
 	flag.StringVar(&localDirPath, "local-dir", "", "Local directory to scan")
 	flag.StringVar(&outputFile, "output", "secrets.csv", "Output CSV file path")
+	flag.IntVar(&pullRequestID, "pull-request", 0, "Scan the lines added by this pull request and comment on each finding")
+	flag.BoolVar(&scanAllRefs, "all-refs", false, "Scan the head of every branch and tag, scanning identical files once")
+	flag.BoolVar(&scanHistory, "history", false, "Scan the added lines of every commit reachable from --commit")
+	flag.BoolVar(&cloneRepo, "clone", false, "Clone the repository over git into a temporary bare repository and scan it locally instead of fetching each file over REST")
+	flag.StringVar(&gitURL, "git-url", "", "Clone and scan this git URL (any URL git accepts, including file://) at --commit (default HEAD)")
+	flag.StringVar(&insightsReport, "insights-report", "", "Publish the results of a commit scan as a Code Insights report with this key (Data Center only)")
+	flag.StringVar(&buildStatus, "build-status", "", "Set a build status with this key on the scanned commit: FAILED when secrets are found, SUCCESSFUL otherwise (Data Center only)")
+	flag.Float64Var(&buildThreshold, "build-status-threshold", 0, "Minimum confidence of a secret that fails the build status")
+	flag.StringVar(&buildURL, "build-status-url", "", "Report URL linked from the build status (default: the commit page)")
+	flag.BoolVar(&blame, "blame", false, "Attribute each finding to the commit and author that last changed its line (file, commit, --all, clone and local scans)")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Cache downloaded files and scan results in this directory and reuse them across runs")
+	flag.StringVar(&rulesFile, "rules", "", "TOML, YAML or JSON file of detection rules that extend or replace the built-in rules")
+	flag.StringVar(&gitleaksConfig, "gitleaks-config", "", "Gitleaks configuration file whose rules and allowlists replace the built-in rules (or extend them with [extend] useDefault)")
+	flag.StringVar(&serveAddr, "serve", "", "Run a webhook server on this address (e.g. :8080) that scans pushes and opened or updated pull requests")
+	flag.StringVar(&webhookSecret, "webhook-secret", os.Getenv("WEBHOOK_SECRET"), "Secret used to verify webhook signatures (default: $WEBHOOK_SECRET)")
+	flag.IntVar(&workers, "workers", 2, "Number of concurrent scans in --serve mode")
+	flag.BoolVar(&scanAll, "all", false, "Scan the default branch of every repository in every project on the server")
+
+	flag.IntVar(&retryPolicy.MaxRetries, "max-retries", retryPolicy.MaxRetries, "Maximum retries for Bitbucket requests that fail with 429, 5xx or a dropped connection")
+	flag.DurationVar(&retryPolicy.InitialBackoff, "retry-backoff", retryPolicy.InitialBackoff, "Initial delay between retries, doubled on each retry")
+	flag.DurationVar(&retryPolicy.MaxBackoff, "max-backoff", retryPolicy.MaxBackoff, "Maximum delay between retries, including delays requested by Retry-After")
+
+	flag.Int64Var(&maxFileSize, "max-file-size", scanner.DefaultMaxFileSize, "Skip files larger than this many bytes (0 means no limit)")
+	flag.StringVar(&skippedOutput, "skipped-output", "", "Write the files that were not scanned, with the reason, to this CSV file")
+	flag.StringVar(&suppressedOut, "suppressed-output", "", "Write the secrets suppressed by allowlists or inline markers, with the reason, to this CSV file")
+
+	flag.StringVar(&username, "username", "", "Bitbucket username for basic auth (instead of --token)")
+	flag.StringVar(&password, "password", "", "Bitbucket password or app password for basic auth")
+	flag.StringVar(&tokenEnv, "token-env", "", "Read the Bitbucket HTTP token from this environment variable")
+	flag.StringVar(&tokenFile, "token-file", "", "Read the Bitbucket HTTP token from this file")
+	flag.StringVar(&caBundle, "ca-bundle", "", "PEM file of additional CA certificates to trust")
+	flag.StringVar(&clientCert, "client-cert", "", "PEM client certificate for mutual TLS (requires --client-key)")
+	flag.StringVar(&clientKey, "client-key", "", "PEM private key for --client-cert")
+	flag.StringVar(&proxyURL, "proxy", "", "HTTP proxy URL for Bitbucket requests (default: from the environment)")
+	flag.DurationVar(&timeout, "timeout", 0, "Maximum duration of each Bitbucket request (0 means no limit)")
+	flag.DurationVar(&scanTimeout, "scan-timeout", 0, "Maximum duration of the whole scan; findings so far are written when it expires (0 means no limit)")
+	flag.DurationVar(&connectTimeout, "connect-timeout", 30*time.Second, "Maximum time to establish a connection to Bitbucket")
 
 	flag.Parse()
 
@@ -50,6 +132,130 @@ func main() {
 		os.Exit(1)
 	}
 
+	hasCredentials := httpToken != "" || tokenEnv != "" || tokenFile != "" || username != ""
+	if scanAll && (baseURL == "" || !hasCredentials) {
+		fmt.Println("Error: --all requires --url and credentials (--token, --token-env, --token-file or --username)")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if hostType != "datacenter" && hostType != "cloud" {
+		fmt.Printf("Error: unknown --host %q, expected datacenter or cloud\n", hostType)
+		os.Exit(1)
+	}
+	if hostType == "cloud" && (scanAll || scanHistory || scanAllRefs || pullRequestID != 0) {
+		fmt.Println("Error: --all, --history, --all-refs and --pull-request are only supported with --host datacenter")
+		os.Exit(1)
+	}
+
+	if blame && hostType == "cloud" && !cloneRepo && gitURL == "" {
+		fmt.Println("Error: --blame is not supported for Bitbucket Cloud API scans; use --clone")
+		os.Exit(1)
+	}
+
+	since, until, err := bitbucket.ParseRange(commitID)
+	if err != nil {
+		fmt.Printf("Error: invalid --commit %v\n", err)
+		os.Exit(1)
+	}
+	isRange := until != ""
+	if isRange && (hostType != "datacenter" || cloneRepo || gitURL != "" || filePath != "" || scanAllRefs || pullRequestID != 0 || insightsReport != "" || buildStatus != "") {
+		fmt.Println("Error: a commit range in --commit is only supported for Data Center commit and history scans")
+		os.Exit(1)
+	}
+
+	if insightsReport != "" && (hostType != "datacenter" || commitID == "" || scanAll || scanHistory || scanAllRefs || pullRequestID != 0 || gitURL != "") {
+		fmt.Println("Error: --insights-report requires a single Data Center commit scan with --project, --repo and --commit")
+		os.Exit(1)
+	}
+
+	if buildStatus != "" && (hostType != "datacenter" || commitID == "" || scanAll || scanHistory || scanAllRefs || pullRequestID != 0 || gitURL != "") {
+		fmt.Println("Error: --build-status requires a single Data Center commit scan with --project, --repo and --commit")
+		os.Exit(1)
+	}
+
+	if serveAddr != "" && (hostType != "datacenter" || baseURL == "" || !hasCredentials || webhookSecret == "") {
+		fmt.Println("Error: --serve requires a Data Center --url, credentials and --webhook-secret")
+		os.Exit(1)
+	}
+
+	if serveAddr != "" && workers < 1 {
+		fmt.Println("Error: --workers must be at least 1")
+		os.Exit(1)
+	}
+
+	if (clientCert == "") != (clientKey == "") {
+		fmt.Println("Error: --client-cert and --client-key must be used together")
+		os.Exit(1)
+	}
+
+	if rulesFile != "" && gitleaksConfig != "" {
+		fmt.Println("Error: --rules and --gitleaks-config cannot be used together")
+		os.Exit(1)
+	}
+
+	// Collect the Bitbucket client options from the auth and transport flags
+	clientOptions := []bitbucket.Option{
+		bitbucket.WithRetryPolicy(retryPolicy),
+		bitbucket.WithConnectTimeout(connectTimeout),
+		bitbucket.WithTimeout(timeout),
+	}
+	if tokenEnv != "" {
+		clientOptions = append(clientOptions, bitbucket.WithTokenFromEnv(tokenEnv))
+	}
+	if tokenFile != "" {
+		clientOptions = append(clientOptions, bitbucket.WithTokenFromFile(tokenFile))
+	}
+	if username != "" {
+		clientOptions = append(clientOptions, bitbucket.WithBasicAuth(username, password))
+	}
+	if caBundle != "" {
+		clientOptions = append(clientOptions, bitbucket.WithCABundle(caBundle))
+	}
+	if clientCert != "" {
+		clientOptions = append(clientOptions, bitbucket.WithClientCertificate(clientCert, clientKey))
+	}
+	if proxyURL != "" {
+		clientOptions = append(clientOptions, bitbucket.WithProxy(proxyURL))
+	}
+
+	newClient := func() *bitbucket.Client {
+		client, err := bitbucket.NewClient(baseURL, httpToken, clientOptions...)
+		if err != nil {
+			fmt.Printf("Error initializing Bitbucket client: %v\n", err)
+			os.Exit(1)
+		}
+		return client
+	}
+
+	newHost := func() bitbucket.RepositoryHost {
+		if hostType != "cloud" {
+			return newClient()
+		}
+		client, err := bitbucket.NewCloudClient(baseURL, httpToken, clientOptions...)
+		if err != nil {
+			fmt.Printf("Error initializing Bitbucket Cloud client: %v\n", err)
+			os.Exit(1)
+		}
+		return client
+	}
+
+	// gitAuthHeader returns the Authorization header used for git over HTTP,
+	// built from the same credentials as the REST client
+	gitAuthHeader := func() string {
+		if !hasCredentials {
+			return ""
+		}
+		client := newClient()
+		if client.Username != "" {
+			return gitrepo.BasicAuth(client.Username, client.Password)
+		}
+		if hostType == "cloud" {
+			return gitrepo.BasicAuth("x-token-auth", client.Token)
+		}
+		return gitrepo.BearerAuth(client.Token)
+	}
+
 	// Initialize CSV writer
 	csvWriter, err := output.NewCSVWriter(outputFile)
 	if err != nil {
@@ -58,77 +264,378 @@ func main() {
 	}
 	defer csvWriter.Close()
 
-	// Initialize the secret detector
+	// Initialize the secret detector with the built-in rules, or with those
+	// of the rules file or Gitleaks configuration
 	detector := scanner.NewSecretDetector()
+	if rulesFile != "" || gitleaksConfig != "" {
+		var rules scanner.RuleSet
+		source := rulesFile
+		if gitleaksConfig != "" {
+			source = gitleaksConfig
+			rules, err = scanner.LoadGitleaksRules(gitleaksConfig)
+		} else {
+			rules, err = scanner.LoadRules(rulesFile)
+		}
+		if err != nil {
+			fmt.Printf("Error loading rules: %v\n", err)
+			os.Exit(1)
+		}
+		detector, err = scanner.NewSecretDetectorWithRules(rules)
+		if err != nil {
+			fmt.Printf("Error in rules file %s: %v\n", source, err)
+			os.Exit(1)
+		}
+	}
+
+	// Cancel the scan on Ctrl-C or SIGTERM, or when the overall deadline passes,
+	// keeping whatever was found so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if scanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scanTimeout)
+		defer cancel()
+	}
 
-	var secrets []scanner.Secret
+	// Open the on-disk cache shared by all scans
+	var scanCache *scanner.ScanCache
+	if cacheDir != "" {
+		scanCache, err = scanner.OpenScanCache(cacheDir)
+		if err != nil {
+			fmt.Printf("Error opening cache: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if serveAddr != "" {
+		// Scan pushes and pull requests as webhooks arrive, until interrupted
+		client := newClient()
+		newScanner := func() *scanner.BitbucketScanner {
+			bitbucketScanner := scanner.NewBitbucketScanner(client, detector)
+			bitbucketScanner.SetMaxFileSize(maxFileSize)
+			bitbucketScanner.SetBlame(blame)
+			bitbucketScanner.SetCache(scanCache)
+			return bitbucketScanner
+		}
+		if err := serveWebhooks(ctx, serveAddr, webhookSecret, workers, newScanner, csvWriter); err != nil {
+			fmt.Printf("Error running webhook server: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var (
+		secrets    []scanner.Secret
+		skipped    []scanner.SkippedFile
+		suppressed []scanner.Secret
+		scanErr    error
+	)
 
 	// Process files based on input flags
 	if localFilePath != "" {
 		// Scan a single local file
 		localScanner := scanner.NewFileScanner(detector)
-		fileSecrets, err := localScanner.ScanFile(localFilePath)
+		localScanner.SetMaxFileSize(maxFileSize)
+		localScanner.SetBlame(blame)
+		localScanner.SetCache(scanCache)
+		fileSecrets, err := localScanner.ScanFile(ctx, localFilePath)
+		secrets = append(secrets, fileSecrets...)
+		skipped = localScanner.Skipped()
+		suppressed = localScanner.Suppressed()
 		if err != nil {
-			fmt.Printf("Error scanning local file: %v\n", err)
-			os.Exit(1)
+			scanErr = fmt.Errorf("scanning local file: %w", err)
 		}
-		secrets = append(secrets, fileSecrets...)
 	} else if localDirPath != "" {
 		// Scan all files in a local directory
 		localScanner := scanner.NewDirectoryScanner(detector)
-		fileSecrets, err := localScanner.ScanDirectory(localDirPath)
+		localScanner.SetMaxFileSize(maxFileSize)
+		localScanner.SetBlame(blame)
+		localScanner.SetCache(scanCache)
+		fileSecrets, err := localScanner.ScanDirectory(ctx, localDirPath)
+		secrets = append(secrets, fileSecrets...)
+		skipped = localScanner.Skipped()
+		suppressed = localScanner.Suppressed()
 		if err != nil {
-			fmt.Printf("Error scanning local directory: %v\n", err)
-			os.Exit(1)
+			scanErr = fmt.Errorf("scanning local directory: %w", err)
+		}
+	} else if cloneRepo || gitURL != "" {
+		// Clone over git and scan the objects locally
+		cloneURL := gitURL
+		if cloneURL == "" {
+			cloneURL = bitbucketCloneURL(hostType, baseURL, projectKey, repoSlug)
+		}
+		rev := commitID
+		if rev == "" {
+			rev = "HEAD"
 		}
-		secrets = append(secrets, fileSecrets...)
-	} else {
-		// Initialize BitBucket client
-		client := bitbucket.NewClient(baseURL, httpToken)
 
-		// Get Bitbucket commit info
-		commit, err := client.GetCommit(projectKey, repoSlug, commitID)
-		if err != nil {
-			fmt.Printf("Error getting commit info: %v\n", err)
-			os.Exit(1)
+		// The Bitbucket credentials are only sent to the Bitbucket server,
+		// not to another host named by --git-url
+		authHeader := ""
+		if gitURL == "" || sameHost(gitURL, baseURL) || sameHost(gitURL, bitbucketCloneURL(hostType, baseURL, projectKey, repoSlug)) {
+			authHeader = gitAuthHeader()
 		}
 
+		cloneSecrets, cloneSkipped, cloneSuppressed, err := scanGitClone(ctx, cloneURL, authHeader, projectKey, repoSlug, rev, detector, maxFileSize, blame, scanCache)
+		secrets = append(secrets, cloneSecrets...)
+		skipped = cloneSkipped
+		suppressed = cloneSuppressed
+		if err != nil {
+			scanErr = fmt.Errorf("scanning git clone: %w", err)
+		}
+	} else if scanAll {
+		// Scan the default branch head of every repository on the server
+		client := newClient()
 		bitbucketScanner := scanner.NewBitbucketScanner(client, detector)
+		bitbucketScanner.SetMaxFileSize(maxFileSize)
+		bitbucketScanner.SetBlame(blame)
+		bitbucketScanner.SetCache(scanCache)
+
+		instanceSecrets, err := bitbucketScanner.ScanInstance(ctx)
+		secrets = append(secrets, instanceSecrets...)
+		skipped = bitbucketScanner.Skipped()
+		suppressed = bitbucketScanner.Suppressed()
+		if err != nil {
+			scanErr = fmt.Errorf("scanning Bitbucket instance: %w", err)
+		}
+	} else {
+		// Initialize the Bitbucket Data Center or Cloud client
+		host := newHost()
+		bitbucketScanner := scanner.NewHostScanner(host, detector)
+		bitbucketScanner.SetMaxFileSize(maxFileSize)
+		bitbucketScanner.SetBlame(blame)
+		bitbucketScanner.SetCache(scanCache)
 
-		if filePath != "" {
-			// Scan a single Bitbucket file
-			fileSecrets, err := bitbucketScanner.ScanBitbucketFile(projectKey, repoSlug, commitID, filePath, commit)
+		// Resolve branch and tag names to the commit they point at, so results
+		// and reports are recorded against a commit ID
+		if commitID != "" && !isRange && pullRequestID == 0 && !scanAllRefs {
+			resolved, err := host.ResolveCommit(ctx, projectKey, repoSlug, commitID)
 			if err != nil {
-				fmt.Printf("Error scanning Bitbucket file: %v\n", err)
+				fmt.Printf("Error resolving --commit %s: %v\n", commitID, err)
 				os.Exit(1)
 			}
-			secrets = append(secrets, fileSecrets...)
+			if resolved != commitID {
+				fmt.Printf("Resolved %s to commit %s\n", commitID, resolved)
+			}
+			commitID = resolved
+		}
+
+		if pullRequestID != 0 {
+			// Scan the pull request diff and comment on each finding
+			prSecrets, err := bitbucketScanner.ScanPullRequest(ctx, projectKey, repoSlug, pullRequestID)
+			secrets = append(secrets, prSecrets...)
+			if err != nil {
+				scanErr = fmt.Errorf("scanning pull request: %w", err)
+			} else {
+				posted, err := bitbucketScanner.CommentOnPullRequest(ctx, projectKey, repoSlug, pullRequestID, prSecrets)
+				if err != nil {
+					fmt.Printf("Warning: Error commenting on pull request: %v\n", err)
+				}
+				fmt.Printf("Posted %d comments on pull request %d\n", posted, pullRequestID)
+			}
+		} else if scanAllRefs {
+			// Scan every branch and tag head
+			refSecrets, err := bitbucketScanner.ScanAllRefs(ctx, projectKey, repoSlug)
+			secrets = append(secrets, refSecrets...)
+			if err != nil {
+				scanErr = fmt.Errorf("scanning branches and tags: %w", err)
+			}
+		} else if isRange {
+			// Scan the diff of each commit in the range
+			rangeSecrets, err := bitbucketScanner.ScanRange(ctx, projectKey, repoSlug, since, until)
+			secrets = append(secrets, rangeSecrets...)
+			if err != nil {
+				scanErr = fmt.Errorf("scanning commit range: %w", err)
+			}
+		} else if scanHistory {
+			// Scan the diff of every commit in the history of --commit
+			historySecrets, err := bitbucketScanner.ScanHistory(ctx, projectKey, repoSlug, commitID)
+			secrets = append(secrets, historySecrets...)
+			if err != nil {
+				scanErr = fmt.Errorf("scanning commit history: %w", err)
+			}
+		} else if filePath != "" {
+			// Get Bitbucket commit info
+			commit, err := host.GetCommit(ctx, projectKey, repoSlug, commitID)
+			if err != nil {
+				scanErr = fmt.Errorf("getting commit info: %w", err)
+			} else {
+				// Scan a single Bitbucket file
+				fileSecrets, err := bitbucketScanner.ScanBitbucketFile(ctx, projectKey, repoSlug, commitID, filePath, commit)
+				secrets = append(secrets, fileSecrets...)
+				if err != nil {
+					scanErr = fmt.Errorf("scanning Bitbucket file: %w", err)
+				}
+			}
 		} else {
 			// Scan all files in the commit
-			fileList, err := client.GetFileList(projectKey, repoSlug, commitID)
+			commitSecrets, err := bitbucketScanner.ScanCommit(ctx, projectKey, repoSlug, commitID)
+			secrets = append(secrets, commitSecrets...)
 			if err != nil {
-				fmt.Printf("Error getting file list: %v\n", err)
-				os.Exit(1)
+				scanErr = fmt.Errorf("scanning commit: %w", err)
 			}
+		}
+		skipped = bitbucketScanner.Skipped()
+		suppressed = bitbucketScanner.Suppressed()
+	}
 
-			for _, file := range fileList {
-				if file.Type == "FILE" {
-					fileSecrets, err := bitbucketScanner.ScanBitbucketFile(projectKey, repoSlug, commitID, file.Path, commit)
-					if err != nil {
-						fmt.Printf("Warning: Error scanning file %s: %v\n", file.Path, err)
-						continue
-					}
-					secrets = append(secrets, fileSecrets...)
-				}
-			}
+	if scanErr != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("Error %v\n", scanErr)
+			os.Exit(1)
 		}
+		// Interrupted or timed out: flush the partial results before exiting
+		fmt.Printf("Scan stopped early (%v). Writing the %d secrets found so far\n", ctx.Err(), len(secrets))
 	}
 
-	// Write secrets to CSV
+	// Write secrets to CSV in a stable order
+	scanner.SortSecrets(secrets)
 	if err := csvWriter.WriteSecrets(secrets); err != nil {
 		fmt.Printf("Error writing to CSV: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Publish the commit scan as a Code Insights report
+	if insightsReport != "" && scanErr == nil {
+		publisher := output.NewInsightsPublisher(newClient(), insightsReport)
+		if err := publisher.Publish(ctx, projectKey, repoSlug, commitID, secrets); err != nil {
+			fmt.Printf("Warning: Error publishing Code Insights report: %v\n", err)
+		} else {
+			fmt.Printf("Published Code Insights report %s on commit %s\n", insightsReport, commitID)
+		}
+	}
+
+	// Gate merges on the scan with a commit build status
+	if buildStatus != "" && scanErr == nil {
+		publisher := output.NewBuildStatusPublisher(newClient(), buildStatus, buildThreshold, buildURL)
+		if state, err := publisher.Publish(ctx, projectKey, repoSlug, commitID, secrets); err != nil {
+			fmt.Printf("Warning: Error setting build status: %v\n", err)
+		} else {
+			fmt.Printf("Set build status %s to %s on commit %s\n", buildStatus, state, commitID)
+		}
+	}
+
+	// Report the files that were not scanned
+	if len(skipped) > 0 {
+		fmt.Printf("Skipped %d binary or oversized files\n", len(skipped))
+	}
+	if skippedOutput != "" {
+		if err := output.WriteSkippedFiles(skippedOutput, skipped); err != nil {
+			fmt.Printf("Error writing skipped files: %v\n", err)
+		}
+	}
+
+	// Report the secrets that allowlists or inline markers suppressed
+	if len(suppressed) > 0 {
+		fmt.Printf("Suppressed %d secrets with allowlists or inline markers\n", len(suppressed))
+	}
+	if suppressedOut != "" {
+		scanner.SortSecrets(suppressed)
+		if err := output.WriteSuppressedSecrets(suppressedOut, suppressed); err != nil {
+			fmt.Printf("Error writing suppressed secrets: %v\n", err)
+		}
+	}
+
+	if scanErr != nil {
+		csvWriter.Close()
+		os.Exit(1)
+	}
+
 	fmt.Printf("Scan complete. Found %d secrets. Results written to %s\n", len(secrets), outputFile)
 }
+
+// bitbucketCloneURL returns the HTTP clone URL of a Bitbucket repository
+func bitbucketCloneURL(hostType, baseURL, projectKey, repoSlug string) string {
+	if hostType == "cloud" {
+		return fmt.Sprintf("https://bitbucket.org/%s/%s.git", projectKey, repoSlug)
+	}
+	return fmt.Sprintf("%s/scm/%s/%s.git", strings.TrimRight(baseURL, "/"), strings.ToLower(projectKey), repoSlug)
+}
+
+// sameHost reports whether two URLs name the same host and port. URLs that
+// do not parse, such as scp-style git addresses, match nothing.
+func sameHost(a, b string) bool {
+	ua, err := neturl.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := neturl.Parse(b)
+	if err != nil || ub.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+// scanGitClone clones cloneURL into a temporary bare repository, scans rev and
+// removes the clone. When projectKey or repoSlug are empty they are taken from
+// the last two path segments of the URL.
+func scanGitClone(ctx context.Context, cloneURL, authHeader, projectKey, repoSlug, rev string, detector *scanner.SecretDetector, maxFileSize int64, blame bool, cache *scanner.ScanCache) ([]scanner.Secret, []scanner.SkippedFile, []scanner.Secret, error) {
+	if projectKey == "" || repoSlug == "" {
+		segments := strings.Split(strings.TrimRight(cloneURL, "/"), "/")
+		if repoSlug == "" {
+			repoSlug = strings.TrimSuffix(segments[len(segments)-1], ".git")
+		}
+		if projectKey == "" && len(segments) > 1 {
+			projectKey = segments[len(segments)-2]
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "secret-scanner-*.git")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := gitrepo.Clone(ctx, cloneURL, dir, authHeader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	gitScanner := scanner.NewGitScanner(repo, detector, projectKey, repoSlug)
+	gitScanner.SetMaxFileSize(maxFileSize)
+	gitScanner.SetBlame(blame)
+	gitScanner.SetCache(cache)
+	secrets, err := gitScanner.ScanCommit(ctx, rev)
+	return secrets, gitScanner.Skipped(), gitScanner.Suppressed(), err
+}
+
+// serveWebhooks runs the webhook server until ctx is cancelled, appending the
+// findings of each scan to the CSV output
+func serveWebhooks(ctx context.Context, addr, secret string, workers int, newScanner func() *scanner.BitbucketScanner, csvWriter *output.CSVWriter) error {
+	server := webhook.NewServer(secret, newScanner, 100, func(job webhook.Job, secrets []scanner.Secret, err error) {
+		if err != nil {
+			log.Printf("Error scanning %s/%s for %s: %v", job.ProjectKey, job.RepositorySlug, job.Event, err)
+			return
+		}
+		log.Printf("Found %d secrets in %s/%s for %s", len(secrets), job.ProjectKey, job.RepositorySlug, job.Event)
+		scanner.SortSecrets(secrets)
+		if err := csvWriter.WriteSecrets(secrets); err != nil {
+			log.Printf("Error writing to CSV: %v", err)
+		}
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", server)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go server.Run(ctx, workers)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Listening for webhooks on %s/webhook", addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -1,3 +1,8 @@
 module bitbucket-secrets-scanner
 
 go 1.20
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
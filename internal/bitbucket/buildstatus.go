@@ -0,0 +1,12 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetBuildStatus creates or replaces the build status with the same key on a commit
+func (c *Client) SetBuildStatus(ctx context.Context, commitID string, status BuildStatus) error {
+	url := fmt.Sprintf("%s/rest/build-status/1.0/commits/%s", c.BaseURL, commitID)
+	return c.doJSON(ctx, "POST", url, status, nil)
+}
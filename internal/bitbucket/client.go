@@ -1,49 +1,87 @@
 package bitbucket
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
 )
 
+// pageLimit is the page size requested from paged Bitbucket endpoints
+const pageLimit = 500
+
 // Client represents a Bitbucket REST API client
 type Client struct {
-	BaseURL string
-	Token   string
-	client  *http.Client
+	BaseURL  string
+	Token    string
+	Username string // With Password, selects basic auth instead of the bearer token
+	Password string
+	Retry    RetryPolicy
+
+	client    *http.Client
+	transport *http.Transport
+	timeout   time.Duration
 }
 
 // NewClient creates a new Bitbucket client
-func NewClient(baseURL, token string) *Client {
-	return &Client{
-		BaseURL: baseURL,
-		Token:   token,
-		client:  &http.Client{},
+func NewClient(baseURL, token string, opts ...Option) (*Client, error) {
+	c := &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Token:     token,
+		Retry:     DefaultRetryPolicy,
+		transport: http.DefaultTransport.(*http.Transport).Clone(),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.client == nil {
+		c.client = &http.Client{
+			Transport: c.transport,
+			Timeout:   c.timeout,
+		}
 	}
+	return c, nil
+}
+
+// authorize adds the client's credentials to a request
+func (c *Client) authorize(req *http.Request) {
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+		return
+	}
+	req.Header.Add("Authorization", "Bearer "+c.Token)
 }
 
 // GetCommit fetches commit information from Bitbucket
-func (c *Client) GetCommit(projectKey, repoSlug, commitID string) (Commit, error) {
+func (c *Client) GetCommit(ctx context.Context, projectKey, repoSlug, commitID string) (Commit, error) {
 	var commit Commit
 
-	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits/%s", c.BaseURL, projectKey, repoSlug, commitID)
-	req, err := http.NewRequest("GET", url, nil)
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits/%s",
+		c.BaseURL, projectKey, repoSlug, neturl.PathEscape(commitID))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return commit, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.Token)
+	c.authorize(req)
 	req.Header.Add("Content-Type", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return commit, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return commit, fmt.Errorf("API request failed with status code %d", resp.StatusCode)
+		return commit, newAPIError(resp)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -59,84 +97,329 @@ func (c *Client) GetCommit(projectKey, repoSlug, commitID string) (Commit, error
 	return commit, nil
 }
 
-// GetFileList fetches a list of files in a commit
-func (c *Client) GetFileList(projectKey, repoSlug, commitID string) ([]File, error) {
+// GetFileList fetches every file in a commit, following pagination so that
+// nested files and files past the first page are included
+func (c *Client) GetFileList(ctx context.Context, projectKey, repoSlug, commitID string) ([]File, error) {
 	var files []File
 
-	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/browse?at=%s", c.BaseURL, projectKey, repoSlug, commitID)
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/files?at=%s",
+		c.BaseURL, projectKey, repoSlug, neturl.QueryEscape(commitID))
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var paths []string
+		if err := json.Unmarshal(values, &paths); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			files = append(files, File{
+				Path: path,
+				Type: "FILE",
+			})
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// GetProjects fetches every project visible to the token
+func (c *Client) GetProjects(ctx context.Context) ([]Project, error) {
+	var projects []Project
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects", c.BaseURL)
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Project
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		projects = append(projects, page...)
+		return nil
+	})
+
+	return projects, err
+}
+
+// GetRepositories fetches every repository in a project
+func (c *Client) GetRepositories(ctx context.Context, projectKey string) ([]Repository, error) {
+	var repos []Repository
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos", c.BaseURL, projectKey)
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Repository
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		repos = append(repos, page...)
+		return nil
+	})
+
+	return repos, err
+}
+
+// GetDefaultBranch fetches the default branch of a repository, including its head commit
+func (c *Client) GetDefaultBranch(ctx context.Context, projectKey, repoSlug string) (Branch, error) {
+	var branch Branch
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches/default", c.BaseURL, projectKey, repoSlug)
+	err := c.getJSON(ctx, url, &branch)
+
+	return branch, err
+}
+
+// GetBranches fetches every branch in a repository
+func (c *Client) GetBranches(ctx context.Context, projectKey, repoSlug string) ([]Branch, error) {
+	var branches []Branch
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches", c.BaseURL, projectKey, repoSlug)
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Branch
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		branches = append(branches, page...)
+		return nil
+	})
+
+	return branches, err
+}
+
+// GetTags fetches every tag in a repository
+func (c *Client) GetTags(ctx context.Context, projectKey, repoSlug string) ([]Tag, error) {
+	var tags []Tag
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/tags", c.BaseURL, projectKey, repoSlug)
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Tag
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		tags = append(tags, page...)
+		return nil
+	})
+
+	return tags, err
+}
+
+// GetCommits fetches every commit reachable from ref, newest first
+func (c *Client) GetCommits(ctx context.Context, projectKey, repoSlug, ref string) ([]Commit, error) {
+	return c.GetCommitRange(ctx, projectKey, repoSlug, "", ref)
+}
+
+// GetCommitRange fetches the commits reachable from until but not from since,
+// newest first. An empty since fetches the whole history of until.
+func (c *Client) GetCommitRange(ctx context.Context, projectKey, repoSlug, since, until string) ([]Commit, error) {
+	var commits []Commit
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits?until=%s",
+		c.BaseURL, projectKey, repoSlug, neturl.QueryEscape(until))
+	if since != "" {
+		url += "&since=" + neturl.QueryEscape(since)
+	}
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Commit
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		commits = append(commits, page...)
+		return nil
+	})
+
+	return commits, err
+}
+
+// GetCommitDiff fetches the changes a commit made relative to since, with one
+// line of context around each change. An empty since diffs against the
+// commit's first parent.
+func (c *Client) GetCommitDiff(ctx context.Context, projectKey, repoSlug, since, commitID string) ([]Diff, error) {
+	commitURL := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits/%s",
+		c.BaseURL, projectKey, repoSlug, neturl.PathEscape(commitID))
+	return c.getDiff(ctx, commitURL, since)
+}
+
+// getDiff fetches the diff of the commit or pull request at url. Bitbucket
+// truncates a large diff, in which case the changed files are listed page by
+// page and the diff of each file is fetched separately.
+func (c *Client) getDiff(ctx context.Context, url, since string) ([]Diff, error) {
+	var response struct {
+		Diffs     []Diff `json:"diffs"`
+		Truncated bool   `json:"truncated"`
+	}
 
-	// This is a simplification - in real implementation we'd need to handle pagination
-	req, err := http.NewRequest("GET", url, nil)
+	query := "?contextLines=1&withComments=false"
+	changesURL := url + "/changes"
+	if since != "" {
+		query += "&since=" + neturl.QueryEscape(since)
+		changesURL += "?since=" + neturl.QueryEscape(since)
+	}
+
+	err := c.getJSON(ctx, url+"/diff"+query, &response)
+	if err != nil || !response.Truncated {
+		return response.Diffs, err
+	}
+
+	var diffs []Diff
+	err = c.getAllPages(ctx, changesURL, func(values json.RawMessage) error {
+		var page []Change
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, change := range page {
+			// Deleted files have no added lines
+			if change.Type == "DELETE" {
+				continue
+			}
+
+			var fileDiff struct {
+				Diffs []Diff `json:"diffs"`
+			}
+			if err := c.getJSON(ctx, url+"/diff/"+escapePath(change.Path.ToString)+query, &fileDiff); err != nil {
+				return fmt.Errorf("getting diff of %s: %w", change.Path.ToString, err)
+			}
+			diffs = append(diffs, fileDiff.Diffs...)
+		}
+		return nil
+	})
+
+	return diffs, err
+}
+
+// GetBlame fetches the commit that last changed each run of lines of a file
+func (c *Client) GetBlame(ctx context.Context, projectKey, repoSlug, commitID, filePath string) ([]Blame, error) {
+	var blame []Blame
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/browse/%s?at=%s&blame=true&noContent=true",
+		c.BaseURL, projectKey, repoSlug, escapePath(filePath), neturl.QueryEscape(commitID))
+	err := c.getJSON(ctx, url, &blame)
+
+	return blame, err
+}
+
+// getAllPages walks a paged Bitbucket endpoint, passing the raw "values" array
+// of each page to handle until the last page has been read
+func (c *Client) getAllPages(ctx context.Context, url string, handle func(values json.RawMessage) error) error {
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+
+	start := 0
+	for {
+		var page struct {
+			PagedResponse
+			Values json.RawMessage `json:"values"`
+		}
+
+		pageURL := fmt.Sprintf("%s%sstart=%d&limit=%d", url, separator, start, pageLimit)
+		if err := c.getJSON(ctx, pageURL, &page); err != nil {
+			return err
+		}
+
+		if len(page.Values) > 0 {
+			if err := handle(page.Values); err != nil {
+				return err
+			}
+		}
+
+		if page.IsLastPage || page.NextPageStart <= start {
+			return nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// getJSON performs an authenticated GET request and decodes the JSON response into v
+func (c *Client) getJSON(ctx context.Context, url string, v interface{}) error {
+	return c.doJSON(ctx, "GET", url, nil, v)
+}
+
+// doJSON performs an authenticated request, encoding in as the JSON request
+// body when it is non-nil and decoding the JSON response into out when it is non-nil
+func (c *Client) doJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var reqBody io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
-		return files, err
+		return err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.Token)
+	c.authorize(req)
 	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return files, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return files, fmt.Errorf("API request failed with status code %d", resp.StatusCode)
-	}
-
-	var response struct {
-		Values []struct {
-			Path string `json:"path"`
-			Type string `json:"type"` // "FILE" or "DIRECTORY"
-		} `json:"values"`
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return files, err
+		return err
+	}
+
+	if out == nil || len(body) == 0 {
+		return nil
 	}
+	return json.Unmarshal(body, out)
+}
 
-	err = json.Unmarshal(body, &response)
+// GetFileContent fetches the content of a file
+func (c *Client) GetFileContent(ctx context.Context, projectKey, repoSlug, commitID, filePath string) (string, error) {
+	content, err := c.OpenFileContent(ctx, projectKey, repoSlug, commitID, filePath)
 	if err != nil {
-		return files, err
+		return "", err
 	}
+	defer content.Close()
 
-	for _, value := range response.Values {
-		files = append(files, File{
-			Path: value.Path,
-			Type: value.Type,
-		})
+	body, err := ioutil.ReadAll(content)
+	if err != nil {
+		return "", err
 	}
 
-	return files, nil
+	return string(body), nil
 }
 
-// GetFileContent fetches the content of a file
-func (c *Client) GetFileContent(projectKey, repoSlug, commitID, filePath string) (string, error) {
+// OpenFileContent streams the content of a file. The caller must close the returned FileContent.
+func (c *Client) OpenFileContent(ctx context.Context, projectKey, repoSlug, commitID, filePath string) (*FileContent, error) {
 	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/raw/%s?at=%s",
-		c.BaseURL, projectKey, repoSlug, filePath, commitID)
+		c.BaseURL, projectKey, repoSlug, escapePath(filePath), neturl.QueryEscape(commitID))
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.Token)
+	c.authorize(req)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status code %d", resp.StatusCode)
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(body), nil
+	return &FileContent{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, nil
 }
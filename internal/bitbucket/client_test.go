@@ -0,0 +1,59 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetCommitDiffTruncated(t *testing.T) {
+	const commitPath = "/rest/api/1.0/projects/PRJ/repos/app/commits/abc123"
+
+	var requests []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch r.URL.Path {
+		case commitPath + "/diff":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"diffs":     []Diff{addedDiff("a.txt", "a")},
+				"truncated": true,
+			})
+		case commitPath + "/changes":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"values": []Change{
+					{Path: DiffPath{ToString: "a.txt"}, Type: "MODIFY"},
+					{Path: DiffPath{ToString: "gone.txt"}, Type: "DELETE"},
+					{Path: DiffPath{ToString: "dir/b.txt"}, Type: "ADD"},
+				},
+				"isLastPage": true,
+			})
+		case commitPath + "/diff/a.txt", commitPath + "/diff/dir/b.txt":
+			path := r.URL.Path[len(commitPath+"/diff/"):]
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"diffs": []Diff{addedDiff(path, path)},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	diffs, err := client.GetCommitDiff(context.Background(), "PRJ", "app", "parent1", "abc123")
+	if err != nil {
+		t.Fatalf("GetCommitDiff: %v", err)
+	}
+	if got, want := diffPaths(diffs), []string{"a.txt", "dir/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diffs of %v, want %v", got, want)
+	}
+
+	want := []string{
+		commitPath + "/diff?contextLines=1&withComments=false&since=parent1",
+		commitPath + "/changes?since=parent1&start=0&limit=500",
+		commitPath + "/diff/a.txt?contextLines=1&withComments=false&since=parent1",
+		commitPath + "/diff/dir/b.txt?contextLines=1&withComments=false&since=parent1",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests\n%v\nwant\n%v", requests, want)
+	}
+}
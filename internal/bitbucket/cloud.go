@@ -0,0 +1,177 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// DefaultCloudURL is the API base URL of Bitbucket Cloud
+const DefaultCloudURL = "https://api.bitbucket.org"
+
+// CloudClient is a Bitbucket Cloud REST API client. It shares authentication,
+// transport and retry handling with Client, but uses the /2.0 API.
+type CloudClient struct {
+	client *Client
+}
+
+// NewCloudClient creates a new Bitbucket Cloud client. An empty baseURL uses DefaultCloudURL.
+func NewCloudClient(baseURL, token string, opts ...Option) (*CloudClient, error) {
+	if baseURL == "" {
+		baseURL = DefaultCloudURL
+	}
+	client, err := NewClient(baseURL, token, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudClient{client: client}, nil
+}
+
+// cloudCommit is a commit as returned by Bitbucket Cloud
+type cloudCommit struct {
+	Hash   string `json:"hash"`
+	Date   string `json:"date"`
+	Author struct {
+		Raw  string `json:"raw"`
+		User struct {
+			DisplayName string `json:"display_name"`
+		} `json:"user"`
+	} `json:"author"`
+	Message string `json:"message"`
+	Parents []struct {
+		Hash string `json:"hash"`
+	} `json:"parents"`
+}
+
+// GetCommit fetches commit information from Bitbucket Cloud. commitID may
+// also be a branch or tag name, whose slashes are kept as path separators.
+func (c *CloudClient) GetCommit(ctx context.Context, workspace, repoSlug, commitID string) (Commit, error) {
+	var response cloudCommit
+
+	url := fmt.Sprintf("%s/2.0/repositories/%s/%s/commit/%s",
+		c.client.BaseURL, neturl.PathEscape(workspace), neturl.PathEscape(repoSlug), escapePath(commitID))
+	if err := c.client.getJSON(ctx, url, &response); err != nil {
+		return Commit{}, err
+	}
+
+	commit := Commit{
+		ID:        response.Hash,
+		DisplayID: shortHash(response.Hash),
+		AuthorObj: parseRawAuthor(response.Author.Raw),
+		Date:      Timestamp(response.Date),
+		Message:   response.Message,
+	}
+	if commit.AuthorObj.Name == "" {
+		commit.AuthorObj.Name = response.Author.User.DisplayName
+	}
+	for _, parent := range response.Parents {
+		commit.Parents = append(commit.Parents, Parent{ID: parent.Hash})
+	}
+
+	return commit, nil
+}
+
+// GetFileList fetches every file in a commit by walking the source tree,
+// following pagination in each directory
+func (c *CloudClient) GetFileList(ctx context.Context, workspace, repoSlug, commitID string) ([]File, error) {
+	var files []File
+
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		dirPath := ""
+		if dir != "" {
+			dirPath = escapePath(dir) + "/"
+		}
+		url := fmt.Sprintf("%s/2.0/repositories/%s/%s/src/%s/%s?pagelen=100",
+			c.client.BaseURL, neturl.PathEscape(workspace), neturl.PathEscape(repoSlug), neturl.PathEscape(commitID), dirPath)
+
+		for url != "" {
+			var page struct {
+				Values []struct {
+					Path string `json:"path"`
+					Type string `json:"type"` // "commit_file" or "commit_directory"
+				} `json:"values"`
+				Next string `json:"next"`
+			}
+			if err := c.client.getJSON(ctx, url, &page); err != nil {
+				return files, err
+			}
+
+			for _, value := range page.Values {
+				switch value.Type {
+				case "commit_file":
+					files = append(files, File{Path: value.Path, Type: "FILE"})
+				case "commit_directory":
+					pending = append(pending, value.Path)
+				}
+			}
+			url = page.Next
+		}
+	}
+
+	return files, nil
+}
+
+// OpenFileContent streams the content of a file from Bitbucket Cloud
+func (c *CloudClient) OpenFileContent(ctx context.Context, workspace, repoSlug, commitID, filePath string) (*FileContent, error) {
+	url := fmt.Sprintf("%s/2.0/repositories/%s/%s/src/%s/%s",
+		c.client.BaseURL, neturl.PathEscape(workspace), neturl.PathEscape(repoSlug), neturl.PathEscape(commitID), escapePath(filePath))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client.authorize(req)
+
+	resp, err := c.client.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+
+	return &FileContent{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, nil
+}
+
+// escapePath escapes each segment of a slash-separated file path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = neturl.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// parseRawAuthor splits a git author of the form "Name <email>"
+func parseRawAuthor(raw string) AuthorObj {
+	start := strings.LastIndex(raw, "<")
+	end := strings.LastIndex(raw, ">")
+	if start < 0 || end < start {
+		return AuthorObj{Name: strings.TrimSpace(raw)}
+	}
+	return AuthorObj{
+		Name:  strings.TrimSpace(raw[:start]),
+		Email: raw[start+1 : end],
+	}
+}
+
+// shortHash abbreviates a commit hash the way Bitbucket displays it
+func shortHash(hash string) string {
+	if len(hash) > 11 {
+		return hash[:11]
+	}
+	return hash
+}
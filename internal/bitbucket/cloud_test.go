@@ -0,0 +1,127 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const cloudRepoPath = "/2.0/repositories/ws/app"
+
+// newTestCloudClient starts an httptest server with handler and returns a
+// Cloud client for it and the server's URL
+func newTestCloudClient(t *testing.T, handler http.HandlerFunc) (*CloudClient, string) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := NewCloudClient(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.client.Retry.MaxRetries = 0
+	return client, srv.URL
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"README.md", "README.md"},
+		{"dir/sub/file.txt", "dir/sub/file.txt"},
+		{"a b/c#d?.txt", "a%20b/c%23d%3F.txt"},
+		{"pct%41.txt", "pct%2541.txt"},
+		{"feature/x", "feature/x"},
+	}
+	for _, tt := range tests {
+		if got := escapePath(tt.path); got != tt.want {
+			t.Errorf("escapePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCloudGetFileList(t *testing.T) {
+	const commitID = "0123456789abcdef0123456789abcdef01234567"
+	srcPath := cloudRepoPath + "/src/" + commitID + "/"
+
+	var baseURL string
+	var requests []string
+	client, baseURL := newTestCloudClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		type entry struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+		var page struct {
+			Values []entry `json:"values"`
+			Next   string  `json:"next,omitempty"`
+		}
+		switch r.URL.RequestURI() {
+		case srcPath + "?pagelen=100":
+			page.Values = []entry{{"README.md", "commit_file"}, {"a b", "commit_directory"}}
+			page.Next = baseURL + srcPath + "?pagelen=100&page=2"
+		case srcPath + "?pagelen=100&page=2":
+			page.Values = []entry{{"main.go", "commit_file"}}
+		case srcPath + "a%20b/?pagelen=100":
+			page.Values = []entry{{"a b/c#d.txt", "commit_file"}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+
+	files, err := client.GetFileList(context.Background(), "ws", "app", commitID)
+	if err != nil {
+		t.Fatalf("GetFileList: %v", err)
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	if want := []string{"README.md", "main.go", "a b/c#d.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got files %v, want %v", paths, want)
+	}
+	if len(requests) != 3 {
+		t.Errorf("got requests %v, want one per page", requests)
+	}
+}
+
+func TestCloudResolveCommit(t *testing.T) {
+	const commitID = "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		rev      string
+		requests []string
+	}{
+		{commitID, nil},
+		{"feature/x", []string{cloudRepoPath + "/commit/feature/x"}},
+		{"v1.0 rc", []string{cloudRepoPath + "/commit/v1.0%20rc"}},
+		{"HEAD", []string{cloudRepoPath, cloudRepoPath + "/commit/main"}},
+	}
+	for _, tt := range tests {
+		var requests []string
+		client, _ := newTestCloudClient(t, func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+			if r.URL.Path == cloudRepoPath {
+				json.NewEncoder(w).Encode(map[string]interface{}{"mainbranch": map[string]string{"name": "main"}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"hash":   commitID,
+				"author": map[string]string{"raw": "Fixture Author <author@example.com>"},
+			})
+		})
+
+		got, err := client.ResolveCommit(context.Background(), "ws", "app", tt.rev)
+		if err != nil || got != commitID {
+			t.Errorf("ResolveCommit(%q) = %q, %v; want %s", tt.rev, got, err, commitID)
+		}
+		if !reflect.DeepEqual(requests, tt.requests) {
+			t.Errorf("ResolveCommit(%q): got requests %v, want %v", tt.rev, requests, tt.requests)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when Bitbucket responds with an unsuccessful status code
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Messages   []string // The errors[].message values from the response body
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API request failed with status code %d (%s %s)", e.StatusCode, e.Method, e.URL)
+	if len(e.Messages) > 0 {
+		msg += ": " + strings.Join(e.Messages, "; ")
+	}
+	return msg
+}
+
+// newAPIError builds an APIError from an unsuccessful response, parsing the
+// Bitbucket error body when there is one
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return apiErr
+	}
+
+	// Data Center reports errors[].message; Cloud reports error.message
+	var errorBody struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errorBody) == nil {
+		for _, e := range errorBody.Errors {
+			if e.Message != "" {
+				apiErr.Messages = append(apiErr.Messages, e.Message)
+			}
+		}
+		if errorBody.Error.Message != "" {
+			apiErr.Messages = append(apiErr.Messages, errorBody.Error.Message)
+		}
+	}
+
+	return apiErr
+}
+
+// statusCode returns the status code of an APIError in err's chain, or 0
+func statusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 response, e.g. a file or commit that does not exist
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is a 401 response, i.e. missing or invalid credentials
+func IsUnauthorized(err error) bool {
+	return statusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is a 403 response, i.e. the credentials lack a permission
+func IsForbidden(err error) bool {
+	return statusCode(err) == http.StatusForbidden
+}
+
+// IsRateLimited reports whether err is a 429 response that was still failing after all retries
+func IsRateLimited(err error) bool {
+	return statusCode(err) == http.StatusTooManyRequests
+}
@@ -0,0 +1,76 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		messages []string
+		check    func(error) bool
+	}{
+		{"Data Center errors", http.StatusNotFound,
+			`{"errors": [{"message": "Repository PRJ/app does not exist."}, {"message": ""}]}`,
+			[]string{"Repository PRJ/app does not exist."}, IsNotFound},
+		{"Cloud error", http.StatusUnauthorized, `{"type": "error", "error": {"message": "Token expired"}}`,
+			[]string{"Token expired"}, IsUnauthorized},
+		{"forbidden", http.StatusForbidden, `{"errors": [{"message": "No permission"}]}`,
+			[]string{"No permission"}, IsForbidden},
+		{"rate limited", http.StatusTooManyRequests, "", nil, IsRateLimited},
+		{"HTML body", http.StatusBadGateway, "<html>Bad gateway</html>", nil, func(error) bool { return true }},
+	}
+	for _, tt := range tests {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		})
+		err := client.getJSON(context.Background(), client.BaseURL+"/rest/api/1.0/projects/PRJ/repos/app", nil)
+
+		apiErr, ok := err.(*APIError)
+		if !ok {
+			t.Errorf("%s: got error %v, want an *APIError", tt.name, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.status || apiErr.Method != http.MethodGet || !reflect.DeepEqual(apiErr.Messages, tt.messages) {
+			t.Errorf("%s: got %+v, want status %d and messages %q", tt.name, apiErr, tt.status, tt.messages)
+		}
+		if !tt.check(err) || !tt.check(fmt.Errorf("listing files: %w", err)) {
+			t.Errorf("%s: the helper does not recognize %v, or the wrapped error", tt.name, err)
+		}
+	}
+}
+
+func TestStatusHelpers(t *testing.T) {
+	notFound := &APIError{StatusCode: http.StatusNotFound}
+	unauthorized := &APIError{StatusCode: http.StatusUnauthorized}
+
+	tests := []struct {
+		name string
+		err  error
+		want [2]bool // IsNotFound, IsUnauthorized
+	}{
+		{"nil", nil, [2]bool{false, false}},
+		{"not an API error", fmt.Errorf("connection refused"), [2]bool{false, false}},
+		{"404", notFound, [2]bool{true, false}},
+		{"wrapped 404", fmt.Errorf("getting file: %w", notFound), [2]bool{true, false}},
+		{"401", unauthorized, [2]bool{false, true}},
+		{"wrapped 401", fmt.Errorf("listing projects: %w", unauthorized), [2]bool{false, true}},
+	}
+	for _, tt := range tests {
+		if got := [2]bool{IsNotFound(tt.err), IsUnauthorized(tt.err)}; got != tt.want {
+			t.Errorf("%s: IsNotFound, IsUnauthorized = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	err := &APIError{StatusCode: 404, Method: "GET", URL: "https://bitbucket.example.com/x", Messages: []string{"a", "b"}}
+	if got, want := err.Error(), "API request failed with status code 404 (GET https://bitbucket.example.com/x): a; b"; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
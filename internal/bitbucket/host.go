@@ -0,0 +1,29 @@
+package bitbucket
+
+import "context"
+
+// RepositoryHost is the part of a Bitbucket API needed to scan the tree of a
+// commit. It is implemented by Client for Bitbucket Data Center and by
+// CloudClient for Bitbucket Cloud. For Bitbucket Cloud, projectKey is the
+// workspace ID.
+type RepositoryHost interface {
+	// GetCommit fetches commit information
+	GetCommit(ctx context.Context, projectKey, repoSlug, commitID string) (Commit, error)
+
+	// ResolveCommit resolves a commit ID, branch, tag or "HEAD" to a full commit ID
+	ResolveCommit(ctx context.Context, projectKey, repoSlug, rev string) (string, error)
+
+	// GetFileList fetches every file in the tree of a commit
+	GetFileList(ctx context.Context, projectKey, repoSlug, commitID string) ([]File, error)
+
+	// OpenFileContent streams the content of a file at a commit
+	OpenFileContent(ctx context.Context, projectKey, repoSlug, commitID, filePath string) (*FileContent, error)
+
+	// WebLinks returns links to the host's web interface
+	WebLinks() WebLinks
+}
+
+var (
+	_ RepositoryHost = (*Client)(nil)
+	_ RepositoryHost = (*CloudClient)(nil)
+)
@@ -0,0 +1,37 @@
+package bitbucket
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+)
+
+// MaxInsightAnnotations is the largest number of annotations Bitbucket accepts on one report
+const MaxInsightAnnotations = 1000
+
+// insightsReportURL returns the URL of a Code Insights report on a commit
+func (c *Client) insightsReportURL(projectKey, repoSlug, commitID, reportKey string) string {
+	return fmt.Sprintf("%s/rest/insights/1.0/projects/%s/repos/%s/commits/%s/reports/%s",
+		c.BaseURL, projectKey, repoSlug, commitID, neturl.PathEscape(reportKey))
+}
+
+// PutInsightReport creates or replaces a Code Insights report on a commit
+func (c *Client) PutInsightReport(ctx context.Context, projectKey, repoSlug, commitID, reportKey string, report InsightReport) error {
+	url := c.insightsReportURL(projectKey, repoSlug, commitID, reportKey)
+	return c.doJSON(ctx, "PUT", url, report, nil)
+}
+
+// DeleteInsightAnnotations removes every annotation from a Code Insights report
+func (c *Client) DeleteInsightAnnotations(ctx context.Context, projectKey, repoSlug, commitID, reportKey string) error {
+	url := c.insightsReportURL(projectKey, repoSlug, commitID, reportKey) + "/annotations"
+	return c.doJSON(ctx, "DELETE", url, nil, nil)
+}
+
+// AddInsightAnnotations adds annotations to a Code Insights report
+func (c *Client) AddInsightAnnotations(ctx context.Context, projectKey, repoSlug, commitID, reportKey string, annotations []InsightAnnotation) error {
+	url := c.insightsReportURL(projectKey, repoSlug, commitID, reportKey) + "/annotations"
+	body := struct {
+		Annotations []InsightAnnotation `json:"annotations"`
+	}{annotations}
+	return c.doJSON(ctx, "POST", url, body, nil)
+}
@@ -0,0 +1,144 @@
+package bitbucket
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// WebLinks builds links to pages of the Bitbucket web interface
+type WebLinks struct {
+	BaseURL string // Web address of the server, e.g. https://bitbucket.example.com
+	Cloud   bool   // Use the Bitbucket Cloud URL layout
+}
+
+// FileURL returns the link to a line of a file at a commit. A line of 0 links
+// to the file itself.
+func (l WebLinks) FileURL(projectKey, repoSlug, commitID, path string, line int) string {
+	if l.BaseURL == "" || projectKey == "" || repoSlug == "" || commitID == "" {
+		return ""
+	}
+
+	var link string
+	if l.Cloud {
+		link = fmt.Sprintf("%s/%s/%s/src/%s/%s", l.BaseURL,
+			neturl.PathEscape(projectKey), neturl.PathEscape(repoSlug), neturl.PathEscape(commitID), escapePath(path))
+		if line > 0 {
+			link += fmt.Sprintf("#lines-%d", line)
+		}
+		return link
+	}
+
+	link = fmt.Sprintf("%s/projects/%s/repos/%s/browse/%s?at=%s", l.BaseURL,
+		neturl.PathEscape(projectKey), neturl.PathEscape(repoSlug), escapePath(path), neturl.QueryEscape(commitID))
+	if line > 0 {
+		link += fmt.Sprintf("#%d", line)
+	}
+	return link
+}
+
+// CommitURL returns the link to a commit
+func (l WebLinks) CommitURL(projectKey, repoSlug, commitID string) string {
+	if l.Cloud {
+		return fmt.Sprintf("%s/%s/%s/commits/%s", l.BaseURL,
+			neturl.PathEscape(projectKey), neturl.PathEscape(repoSlug), neturl.PathEscape(commitID))
+	}
+	return fmt.Sprintf("%s/projects/%s/repos/%s/commits/%s", l.BaseURL,
+		neturl.PathEscape(projectKey), neturl.PathEscape(repoSlug), neturl.PathEscape(commitID))
+}
+
+// WebLinks returns links to the web interface of the Data Center server
+func (c *Client) WebLinks() WebLinks {
+	return WebLinks{BaseURL: c.BaseURL}
+}
+
+// WebLinks returns links to the Bitbucket Cloud web interface. The API host
+// api.bitbucket.org serves its web pages from bitbucket.org.
+func (c *CloudClient) WebLinks() WebLinks {
+	base := c.client.BaseURL
+	if u, err := neturl.Parse(base); err == nil {
+		u.Host = strings.TrimPrefix(u.Host, "api.")
+		base = strings.TrimRight(u.String(), "/")
+	}
+	return WebLinks{BaseURL: base, Cloud: true}
+}
+
+// Remote is a Bitbucket repository identified by a git remote URL
+type Remote struct {
+	Links          WebLinks
+	ProjectKey     string // Workspace ID for Bitbucket Cloud
+	RepositorySlug string
+}
+
+// ParseRemote identifies the Bitbucket repository a git remote URL points at.
+// It understands Data Center HTTP(S) clone URLs (.../scm/PROJECT/repo.git),
+// Data Center SSH URLs (ssh://git@host:7999/project/repo.git) and Bitbucket
+// Cloud HTTPS and SSH URLs. Data Center SSH URLs are assumed to be served
+// over HTTPS from the same host, without a context path.
+func ParseRemote(remote string) (Remote, bool) {
+	remote = strings.TrimSpace(remote)
+
+	// scp-like syntax: git@bitbucket.org:workspace/repo.git
+	if !strings.Contains(remote, "://") {
+		hostPart, path, found := strings.Cut(remote, ":")
+		if !found {
+			return Remote{}, false
+		}
+		if i := strings.LastIndex(hostPart, "@"); i >= 0 {
+			hostPart = hostPart[i+1:]
+		}
+		remote = "ssh://" + hostPart + "/" + path
+	}
+
+	u, err := neturl.Parse(remote)
+	if err != nil || u.Hostname() == "" {
+		return Remote{}, false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return Remote{}, false
+	}
+	projectKey := segments[len(segments)-2]
+	repoSlug := strings.TrimSuffix(segments[len(segments)-1], ".git")
+	if projectKey == "" || repoSlug == "" {
+		return Remote{}, false
+	}
+
+	if u.Hostname() == "bitbucket.org" {
+		return Remote{
+			Links:          WebLinks{BaseURL: "https://bitbucket.org", Cloud: true},
+			ProjectKey:     projectKey,
+			RepositorySlug: repoSlug,
+		}, true
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		// Data Center serves clones under {context}/scm/
+		if len(segments) < 3 || segments[len(segments)-3] != "scm" {
+			return Remote{}, false
+		}
+		contextPath := strings.Join(segments[:len(segments)-3], "/")
+		base := u.Scheme + "://" + u.Host
+		if contextPath != "" {
+			base += "/" + contextPath
+		}
+		return Remote{
+			Links:          WebLinks{BaseURL: base},
+			ProjectKey:     projectKey,
+			RepositorySlug: repoSlug,
+		}, true
+	case "ssh":
+		if len(segments) != 2 {
+			return Remote{}, false
+		}
+		return Remote{
+			Links:          WebLinks{BaseURL: "https://" + u.Hostname()},
+			ProjectKey:     projectKey,
+			RepositorySlug: repoSlug,
+		}, true
+	}
+
+	return Remote{}, false
+}
@@ -1,16 +1,57 @@
 package bitbucket
 
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
 // File represents a file in Bitbucket
 type File struct {
 	Path string
 	Type string // "FILE" or "DIRECTORY"
 }
 
+// FileContent is the streamed body of a file
+type FileContent struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64 // -1 when the server did not send a length
+}
+
 // Commit represents a commit in Bitbucket
 type Commit struct {
 	ID        string    `json:"id"`
+	DisplayID string    `json:"displayId"`
 	AuthorObj AuthorObj `json:"author"`
-	Date      string    `json:"authorTimestamp"`
+	Date      Timestamp `json:"authorTimestamp"`
+	Message   string    `json:"message"`
+	Parents   []Parent  `json:"parents"`
+}
+
+// Parent identifies a parent of a commit
+type Parent struct {
+	ID string `json:"id"`
+}
+
+// Timestamp is an RFC 3339 date string. Bitbucket reports commit timestamps
+// as milliseconds since the epoch, which are converted when decoding.
+type Timestamp string
+
+// UnmarshalJSON accepts either epoch milliseconds or a date string
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var millis int64
+	if err := json.Unmarshal(data, &millis); err == nil {
+		*t = Timestamp(time.UnixMilli(millis).UTC().Format(time.RFC3339))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = Timestamp(s)
+	return nil
 }
 
 // AuthorObj represents the author of a commit
@@ -18,3 +59,161 @@ type AuthorObj struct {
 	Name  string `json:"name"`
 	Email string `json:"emailAddress"`
 }
+
+// PagedResponse holds the paging fields common to Bitbucket list endpoints
+type PagedResponse struct {
+	Size          int  `json:"size"`
+	Limit         int  `json:"limit"`
+	IsLastPage    bool `json:"isLastPage"`
+	Start         int  `json:"start"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// Project represents a Bitbucket project
+type Project struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Repository represents a repository within a Bitbucket project
+type Repository struct {
+	Slug    string  `json:"slug"`
+	Name    string  `json:"name"`
+	Project Project `json:"project"`
+}
+
+// Branch represents a branch reference in a Bitbucket repository
+type Branch struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+	IsDefault    bool   `json:"isDefault"`
+}
+
+// Tag represents a tag reference in a Bitbucket repository. LatestCommit is
+// the commit the tag points at, peeled through annotated tags.
+type Tag struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+	Hash         string `json:"hash"`
+}
+
+// Diff represents the changes made to a single file
+type Diff struct {
+	Source      *DiffPath `json:"source"`
+	Destination *DiffPath `json:"destination"`
+	Binary      bool      `json:"binary"`
+	Hunks       []Hunk    `json:"hunks"`
+}
+
+// DiffPath identifies the file on one side of a diff
+type DiffPath struct {
+	ToString string `json:"toString"`
+}
+
+// Hunk is a contiguous block of changes within a file diff
+type Hunk struct {
+	SourceLine      int       `json:"sourceLine"`
+	SourceSpan      int       `json:"sourceSpan"`
+	DestinationLine int       `json:"destinationLine"`
+	DestinationSpan int       `json:"destinationSpan"`
+	Segments        []Segment `json:"segments"`
+}
+
+// Segment is a run of lines in a hunk that share a type: "ADDED", "REMOVED" or "CONTEXT"
+type Segment struct {
+	Type  string     `json:"type"`
+	Lines []DiffLine `json:"lines"`
+}
+
+// DiffLine is a single line of a diff segment
+type DiffLine struct {
+	Source      int    `json:"source"`
+	Destination int    `json:"destination"`
+	Line        string `json:"line"`
+}
+
+// Change is a file changed by a pull request
+type Change struct {
+	Path DiffPath `json:"path"`
+	Type string   `json:"type"` // "ADD", "MODIFY", "DELETE", "MOVE" or "COPY"
+}
+
+// PullRequest represents a Bitbucket pull request
+type PullRequest struct {
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	FromRef Ref    `json:"fromRef"`
+	ToRef   Ref    `json:"toRef"`
+}
+
+// Ref represents one side of a pull request
+type Ref struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+// Comment is a pull request comment, optionally anchored to a line of the diff
+type Comment struct {
+	ID     int            `json:"id,omitempty"`
+	Text   string         `json:"text"`
+	Anchor *CommentAnchor `json:"anchor,omitempty"`
+}
+
+// CommentAnchor places a comment on a line of a file in the pull request diff
+type CommentAnchor struct {
+	Path     string `json:"path"`
+	Line     int    `json:"line,omitempty"`
+	LineType string `json:"lineType,omitempty"` // "ADDED", "REMOVED" or "CONTEXT"
+	FileType string `json:"fileType,omitempty"` // "FROM" or "TO"
+	DiffType string `json:"diffType,omitempty"` // "EFFECTIVE", "COMMIT" or "RANGE"
+}
+
+// InsightReport is a Code Insights report attached to a commit
+type InsightReport struct {
+	Title    string            `json:"title"`
+	Details  string            `json:"details,omitempty"`
+	Result   string            `json:"result,omitempty"` // "PASS" or "FAIL"
+	Reporter string            `json:"reporter,omitempty"`
+	Link     string            `json:"link,omitempty"`
+	Data     []InsightDataItem `json:"data,omitempty"`
+}
+
+// InsightDataItem is a summary value shown on a Code Insights report
+type InsightDataItem struct {
+	Title string      `json:"title"`
+	Type  string      `json:"type"` // "BOOLEAN", "DATE", "DURATION", "LINK", "NUMBER", "PERCENTAGE" or "TEXT"
+	Value interface{} `json:"value"`
+}
+
+// InsightAnnotation is a Code Insights annotation on a line of a file
+type InsightAnnotation struct {
+	ExternalID string `json:"externalId,omitempty"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Message    string `json:"message"`
+	Severity   string `json:"severity"`       // "LOW", "MEDIUM" or "HIGH"
+	Type       string `json:"type,omitempty"` // "VULNERABILITY", "CODE_SMELL" or "BUG"
+	Link       string `json:"link,omitempty"`
+}
+
+// BuildStatus is a build result attached to a commit
+type BuildStatus struct {
+	State       string `json:"state"` // "SUCCESSFUL", "FAILED" or "INPROGRESS"
+	Key         string `json:"key"`
+	Name        string `json:"name,omitempty"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Blame attributes a run of lines of a file to the commit that last changed them
+type Blame struct {
+	Author          AuthorObj `json:"author"`
+	AuthorTimestamp Timestamp `json:"authorTimestamp"`
+	CommitHash      string    `json:"commitHash"`
+	LineNumber      int       `json:"lineNumber"`
+	SpannedLines    int       `json:"spannedLines"`
+}
@@ -0,0 +1,149 @@
+package bitbucket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option configures a Client created by NewClient
+type Option func(*Client) error
+
+// WithRetryPolicy sets how failed requests are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		c.Retry = policy
+		return nil
+	}
+}
+
+// WithBasicAuth authenticates with a username and a password or app password
+// instead of a bearer token
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) error {
+		if username == "" {
+			return fmt.Errorf("basic auth requires a username")
+		}
+		c.Username = username
+		c.Password = password
+		return nil
+	}
+}
+
+// WithTokenFromEnv reads the bearer token from an environment variable
+func WithTokenFromEnv(name string) Option {
+	return func(c *Client) error {
+		token := strings.TrimSpace(os.Getenv(name))
+		if token == "" {
+			return fmt.Errorf("environment variable %s is not set", name)
+		}
+		c.Token = token
+		return nil
+	}
+}
+
+// WithTokenFromFile reads the bearer token from a file, ignoring surrounding whitespace
+func WithTokenFromFile(path string) Option {
+	return func(c *Client) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return fmt.Errorf("token file %s is empty", path)
+		}
+		c.Token = token
+		return nil
+	}
+}
+
+// WithCABundle trusts the PEM certificates in path in addition to the system roots
+func WithCABundle(path string) Option {
+	return func(c *Client) error {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", path)
+		}
+
+		tlsConfig(c).RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificate presents a client certificate for mutual TLS
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading client certificate: %w", err)
+		}
+
+		config := tlsConfig(c)
+		config.Certificates = append(config.Certificates, cert)
+		return nil
+	}
+}
+
+// WithProxy sends all requests through an explicit HTTP proxy instead of the
+// proxy configured in the environment
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) error {
+		proxy, err := neturl.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("parsing proxy URL: %w", err)
+		}
+		c.transport.Proxy = http.ProxyURL(proxy)
+		return nil
+	}
+}
+
+// WithTimeout limits the total time of each request, including reading the response body
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithConnectTimeout limits the time spent establishing a connection and completing the TLS handshake
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.transport.DialContext = (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		c.transport.TLSHandshakeTimeout = timeout
+		return nil
+	}
+}
+
+// WithHTTPClient uses the given HTTP client as-is, ignoring the transport and timeout options
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) error {
+		c.client = client
+		return nil
+	}
+}
+
+// tlsConfig returns the client transport's TLS configuration, creating it if needed
+func tlsConfig(c *Client) *tls.Config {
+	if c.transport.TLSClientConfig == nil {
+		c.transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.transport.TLSClientConfig
+}
@@ -0,0 +1,56 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+)
+
+// GetPullRequest fetches a pull request
+func (c *Client) GetPullRequest(ctx context.Context, projectKey, repoSlug string, pullRequestID int) (PullRequest, error) {
+	var pullRequest PullRequest
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d",
+		c.BaseURL, projectKey, repoSlug, pullRequestID)
+	err := c.getJSON(ctx, url, &pullRequest)
+
+	return pullRequest, err
+}
+
+// GetPullRequestDiff fetches the effective diff of a pull request, with one
+// line of context around each change
+func (c *Client) GetPullRequestDiff(ctx context.Context, projectKey, repoSlug string, pullRequestID int) ([]Diff, error) {
+	pullRequestURL := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d",
+		c.BaseURL, projectKey, repoSlug, pullRequestID)
+	return c.getDiff(ctx, pullRequestURL, "")
+}
+
+// GetPullRequestComments fetches the comments anchored to a file of a pull request
+func (c *Client) GetPullRequestComments(ctx context.Context, projectKey, repoSlug string, pullRequestID int, path string) ([]Comment, error) {
+	var comments []Comment
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/comments?path=%s",
+		c.BaseURL, projectKey, repoSlug, pullRequestID, neturl.QueryEscape(path))
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Comment
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		comments = append(comments, page...)
+		return nil
+	})
+
+	return comments, err
+}
+
+// AddPullRequestComment posts a comment on a pull request and returns the created comment
+func (c *Client) AddPullRequestComment(ctx context.Context, projectKey, repoSlug string, pullRequestID int, comment Comment) (Comment, error) {
+	var created Comment
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests/%d/comments",
+		c.BaseURL, projectKey, repoSlug, pullRequestID)
+	err := c.doJSON(ctx, "POST", url, comment, &created)
+
+	return created, err
+}
@@ -0,0 +1,190 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const pullRequestPath = "/rest/api/1.0/projects/PRJ/repos/app/pull-requests/7"
+
+// newTestClient starts an httptest server with handler and returns a client for it
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Retry.MaxRetries = 0
+	return client
+}
+
+// addedDiff returns the diff of a file that adds one line
+func addedDiff(path, line string) Diff {
+	return Diff{
+		Destination: &DiffPath{ToString: path},
+		Hunks: []Hunk{{
+			DestinationLine: 1,
+			DestinationSpan: 1,
+			Segments: []Segment{{
+				Type:  "ADDED",
+				Lines: []DiffLine{{Destination: 1, Line: line}},
+			}},
+		}},
+	}
+}
+
+// diffPaths returns the destination path of each diff
+func diffPaths(diffs []Diff) []string {
+	var paths []string
+	for _, diff := range diffs {
+		paths = append(paths, diff.Destination.ToString)
+	}
+	return paths
+}
+
+func TestGetPullRequestDiff(t *testing.T) {
+	var requests []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"diffs": []Diff{addedDiff("a.txt", "a"), addedDiff("b.txt", "b")},
+		})
+	})
+
+	diffs, err := client.GetPullRequestDiff(context.Background(), "PRJ", "app", 7)
+	if err != nil {
+		t.Fatalf("GetPullRequestDiff: %v", err)
+	}
+	if got, want := diffPaths(diffs), []string{"a.txt", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diffs of %v, want %v", got, want)
+	}
+	if want := []string{pullRequestPath + "/diff?contextLines=1&withComments=false"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %v, want %v", requests, want)
+	}
+}
+
+func TestGetPullRequestDiffTruncated(t *testing.T) {
+	changes := []Change{
+		{Path: DiffPath{ToString: "a.txt"}, Type: "MODIFY"},
+		{Path: DiffPath{ToString: "gone.txt"}, Type: "DELETE"},
+		{Path: DiffPath{ToString: "dir/b c#.txt"}, Type: "ADD"},
+	}
+
+	var requests []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch r.URL.Path {
+		case pullRequestPath + "/diff":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"diffs":     []Diff{addedDiff("a.txt", "a")},
+				"truncated": true,
+			})
+		case pullRequestPath + "/changes":
+			// Two changes per page
+			var start int
+			fmt.Sscan(r.URL.Query().Get("start"), &start)
+			end := start + 2
+			if end > len(changes) {
+				end = len(changes)
+			}
+			page := map[string]interface{}{
+				"start":      start,
+				"values":     changes[start:end],
+				"isLastPage": end == len(changes),
+			}
+			if end < len(changes) {
+				page["nextPageStart"] = end
+			}
+			json.NewEncoder(w).Encode(page)
+		case pullRequestPath + "/diff/a.txt", pullRequestPath + "/diff/dir/b c#.txt":
+			path := r.URL.Path[len(pullRequestPath+"/diff/"):]
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"diffs": []Diff{addedDiff(path, path)},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	diffs, err := client.GetPullRequestDiff(context.Background(), "PRJ", "app", 7)
+	if err != nil {
+		t.Fatalf("GetPullRequestDiff: %v", err)
+	}
+	if got, want := diffPaths(diffs), []string{"a.txt", "dir/b c#.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diffs of %v, want %v", got, want)
+	}
+
+	want := []string{
+		pullRequestPath + "/diff?contextLines=1&withComments=false",
+		pullRequestPath + "/changes?start=0&limit=500",
+		pullRequestPath + "/diff/a.txt?contextLines=1&withComments=false",
+		pullRequestPath + "/changes?start=2&limit=500",
+		pullRequestPath + "/diff/dir/b%20c%23.txt?contextLines=1&withComments=false",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests\n%v\nwant\n%v", requests, want)
+	}
+}
+
+func TestAddPullRequestComment(t *testing.T) {
+	var (
+		method, path, contentType, authorization string
+		body                                     map[string]interface{}
+	)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		contentType = r.Header.Get("Content-Type")
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding comment: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id": 12, "text": "created"}`)
+	})
+
+	created, err := client.AddPullRequestComment(context.Background(), "PRJ", "app", 7, Comment{
+		Text: "Possible secret",
+		Anchor: &CommentAnchor{
+			Path:     "config/app.yml",
+			Line:     3,
+			LineType: "ADDED",
+			FileType: "TO",
+			DiffType: "EFFECTIVE",
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddPullRequestComment: %v", err)
+	}
+	if created.ID != 12 {
+		t.Errorf("got created comment %d, want 12", created.ID)
+	}
+
+	if method != http.MethodPost || path != pullRequestPath+"/comments" {
+		t.Errorf("got %s %s, want POST %s/comments", method, path, pullRequestPath)
+	}
+	if contentType != "application/json" || authorization != "Bearer token" {
+		t.Errorf("got Content-Type %q and Authorization %q", contentType, authorization)
+	}
+	wantBody := map[string]interface{}{
+		"text": "Possible secret",
+		"anchor": map[string]interface{}{
+			"path":     "config/app.yml",
+			"line":     float64(3),
+			"lineType": "ADDED",
+			"fileType": "TO",
+			"diffType": "EFFECTIVE",
+		},
+	}
+	if !reflect.DeepEqual(body, wantBody) {
+		t.Errorf("got comment body %v, want %v", body, wantBody)
+	}
+}
@@ -0,0 +1,142 @@
+package bitbucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// fullCommitID matches a complete commit ID, which needs no ref lookup
+var fullCommitID = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// ParseRange splits a revision range "A..B" into the commit to start after and
+// the commit to end at. It returns empty strings when rev is not a range.
+// "A...B" is rejected, since the commits API has no symmetric difference.
+func ParseRange(rev string) (since, until string, err error) {
+	if strings.Contains(rev, "...") {
+		return "", "", fmt.Errorf("%s: symmetric difference ranges (A...B) are not supported, use A..B", rev)
+	}
+	since, until, ok := strings.Cut(rev, "..")
+	if !ok {
+		return "", "", nil
+	}
+	if since == "" || until == "" {
+		return "", "", fmt.Errorf("%s: a range needs both ends, as in A..B", rev)
+	}
+	return since, until, nil
+}
+
+// ResolveCommit resolves a revision to a full commit ID. rev may be a commit
+// ID, a branch name, a tag name, any other ref, or "HEAD" for the head of the
+// default branch. Branches are preferred over tags of the same name.
+func (c *Client) ResolveCommit(ctx context.Context, projectKey, repoSlug, rev string) (string, error) {
+	if fullCommitID.MatchString(rev) {
+		return rev, nil
+	}
+
+	if rev == "HEAD" {
+		branch, err := c.GetDefaultBranch(ctx, projectKey, repoSlug)
+		if err != nil {
+			return "", fmt.Errorf("getting default branch: %w", err)
+		}
+		return branch.LatestCommit, nil
+	}
+
+	branch, found, err := c.FindBranch(ctx, projectKey, repoSlug, rev)
+	if err != nil {
+		return "", fmt.Errorf("finding branch %s: %w", rev, err)
+	}
+	if found {
+		return branch.LatestCommit, nil
+	}
+
+	tag, err := c.GetTag(ctx, projectKey, repoSlug, strings.TrimPrefix(rev, "refs/tags/"))
+	if err == nil {
+		return tag.LatestCommit, nil
+	}
+	if !IsNotFound(err) {
+		return "", fmt.Errorf("getting tag %s: %w", rev, err)
+	}
+
+	// Abbreviated commit IDs and other refs, such as pull request refs, which
+	// cannot be passed as a path segment, resolve to the newest commit the
+	// commits API lists for them
+	var page struct {
+		PagedResponse
+		Values []Commit `json:"values"`
+	}
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/commits?until=%s&limit=1",
+		c.BaseURL, projectKey, repoSlug, neturl.QueryEscape(rev))
+	if err := c.getJSON(ctx, url, &page); err != nil {
+		return "", fmt.Errorf("resolving %s: %w", rev, err)
+	}
+	if len(page.Values) == 0 {
+		return "", fmt.Errorf("resolving %s: no commits found", rev)
+	}
+	return page.Values[0].ID, nil
+}
+
+// FindBranch looks up a branch by its name or full ref ID
+func (c *Client) FindBranch(ctx context.Context, projectKey, repoSlug, name string) (Branch, bool, error) {
+	var match Branch
+	found := false
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches?filterText=%s",
+		c.BaseURL, projectKey, repoSlug, neturl.QueryEscape(strings.TrimPrefix(name, "refs/heads/")))
+
+	err := c.getAllPages(ctx, url, func(values json.RawMessage) error {
+		var page []Branch
+		if err := json.Unmarshal(values, &page); err != nil {
+			return err
+		}
+		for _, branch := range page {
+			if branch.DisplayID == name || branch.ID == name {
+				match = branch
+				found = true
+			}
+		}
+		return nil
+	})
+
+	return match, found, err
+}
+
+// GetTag fetches a tag by name
+func (c *Client) GetTag(ctx context.Context, projectKey, repoSlug, name string) (Tag, error) {
+	var tag Tag
+
+	url := fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/tags/%s", c.BaseURL, projectKey, repoSlug, escapePath(name))
+	err := c.getJSON(ctx, url, &tag)
+
+	return tag, err
+}
+
+// ResolveCommit resolves a revision to a full commit ID. Bitbucket Cloud
+// resolves branch and tag names itself; "HEAD" is the head of the main branch.
+func (c *CloudClient) ResolveCommit(ctx context.Context, workspace, repoSlug, rev string) (string, error) {
+	if fullCommitID.MatchString(rev) {
+		return rev, nil
+	}
+
+	if rev == "HEAD" {
+		var repo struct {
+			MainBranch struct {
+				Name string `json:"name"`
+			} `json:"mainbranch"`
+		}
+		url := fmt.Sprintf("%s/2.0/repositories/%s/%s", c.client.BaseURL, neturl.PathEscape(workspace), neturl.PathEscape(repoSlug))
+		if err := c.client.getJSON(ctx, url, &repo); err != nil {
+			return "", fmt.Errorf("getting main branch: %w", err)
+		}
+		rev = repo.MainBranch.Name
+	}
+
+	commit, err := c.GetCommit(ctx, workspace, repoSlug, rev)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", rev, err)
+	}
+	return commit.ID, nil
+}
@@ -0,0 +1,89 @@
+package bitbucket_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/pkg/bbtest"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		rev          string
+		since, until string
+		wantErr      bool
+	}{
+		{"main", "", "", false},
+		{"0123456789abcdef0123456789abcdef01234567", "", "", false},
+		{"main..feature/login", "main", "feature/login", false},
+		{"v1.0..HEAD", "v1.0", "HEAD", false},
+		{"main...feature", "", "", true},
+		{"main..", "", "", true},
+		{"..feature", "", "", true},
+	}
+	for _, tt := range tests {
+		since, until, err := bitbucket.ParseRange(tt.rev)
+		if since != tt.since || until != tt.until || (err != nil) != tt.wantErr {
+			t.Errorf("ParseRange(%q) = %q, %q, %v; want %q, %q, error %v", tt.rev, since, until, err, tt.since, tt.until, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveCommit(t *testing.T) {
+	srv := bbtest.NewServer()
+	defer srv.Close()
+	client, err := bitbucket.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := srv.AddRepository("PRJ", "app")
+	first := repo.Commit("main", bbtest.Change{Message: "First", Files: map[string]string{"a.txt": "a\n"}})
+	head := repo.Commit("main", bbtest.Change{Message: "Second", Files: map[string]string{"b.txt": "b\n"}})
+	repo.Branch("feature/x", first)
+	repo.Tag("v1.0", first)
+
+	// A branch and a tag with the same name: the branch wins
+	repo.Branch("release", head)
+	repo.Tag("release", first)
+
+	tests := []struct {
+		rev      string
+		want     string
+		requests []string // Endpoint of each request, in order
+	}{
+		{first, first, nil},
+		{"HEAD", head, []string{"/branches/default"}},
+		{"feature/x", first, []string{"/branches?"}},
+		{"refs/heads/feature/x", first, []string{"/branches?"}},
+		{"release", head, []string{"/branches?"}},
+		{"v1.0", first, []string{"/branches?", "/tags/v1.0"}},
+		{"refs/tags/v1.0", first, []string{"/branches?", "/tags/v1.0"}},
+		{first[:12], first, []string{"/branches?", "/tags/", "/commits?"}},
+	}
+	for _, tt := range tests {
+		before := len(srv.Requests())
+		got, err := client.ResolveCommit(context.Background(), "PRJ", "app", tt.rev)
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveCommit(%q) = %q, %v; want %s", tt.rev, got, err, tt.want)
+			continue
+		}
+
+		requests := srv.Requests()[before:]
+		if len(requests) != len(tt.requests) {
+			t.Errorf("ResolveCommit(%q): got requests %v, want %v", tt.rev, requests, tt.requests)
+			continue
+		}
+		for i, endpoint := range tt.requests {
+			if !strings.Contains(requests[i], "/repos/app"+endpoint) {
+				t.Errorf("ResolveCommit(%q): request %d is %s, want %s", tt.rev, i+1, requests[i], endpoint)
+			}
+		}
+	}
+
+	if _, err := client.ResolveCommit(context.Background(), "PRJ", "app", "missing"); err == nil {
+		t.Error("ResolveCommit of a missing revision succeeded")
+	}
+}
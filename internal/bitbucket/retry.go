@@ -0,0 +1,147 @@
+package bitbucket
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxRetries     int           // Retries after the first attempt; 0 disables retries
+	InitialBackoff time.Duration // Delay before the first retry, doubled for each further retry
+	MaxBackoff     time.Duration // Upper bound for any single delay, including Retry-After
+}
+
+// DefaultRetryPolicy is the retry policy used by NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     60 * time.Second,
+}
+
+// do sends a request, retrying server errors, rate limiting and dropped
+// connections according to the client's retry policy. Requests that are not
+// idempotent, such as posting a comment, are only retried when the server
+// says it did not process them.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry request with a non-rewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.client.Do(req)
+		if attempt >= c.Retry.MaxRetries || req.Context().Err() != nil || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		delay := c.Retry.backoff(attempt)
+		if err != nil {
+			log.Printf("Retrying %s %s in %v after error: %v", req.Method, req.URL.Path, delay, err)
+		} else {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+				if c.Retry.MaxBackoff > 0 && delay > c.Retry.MaxBackoff {
+					delay = c.Retry.MaxBackoff
+				}
+			}
+			log.Printf("Retrying %s %s in %v after status code %d", req.Method, req.URL.Path, delay, resp.StatusCode)
+
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a request that produced resp or err may succeed
+// if sent again
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !idempotent(req.Method) {
+		// The server may have acted on the request before failing, so only
+		// rate limiting and overload with a Retry-After are safe to retry
+		return err == nil && (resp.StatusCode == http.StatusTooManyRequests ||
+			(resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != ""))
+	}
+
+	if err != nil {
+		var netErr net.Error
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF) ||
+			(errors.As(err, &netErr) && netErr.Timeout())
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent reports whether sending a request with method twice has the
+// same effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before retry number attempt+1: exponential growth
+// from InitialBackoff with full jitter, capped at MaxBackoff
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff << uint(attempt)
+	if delay <= 0 || (p.MaxBackoff > 0 && delay > p.MaxBackoff) {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
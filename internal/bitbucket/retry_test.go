@@ -0,0 +1,126 @@
+package bitbucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryClient returns a client for a server that responds with each of
+// statuses in turn and then with 200, counting the requests it receives
+func newRetryClient(t *testing.T, retryAfter string, statuses ...int) (*Client, *int32) {
+	t.Helper()
+	var requests int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			fmt.Fprint(w, `{"errors": [{"message": "try again"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+	client.Retry = RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	return client, &requests
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		retryAfter string
+		statuses   []int
+		wantErr    int // Status code of the expected error, or 0
+		requests   int32
+	}{
+		{"GET after 500", http.MethodGet, "", []int{500, 502}, 0, 3},
+		{"GET after 429", http.MethodGet, "0", []int{429}, 0, 2},
+		{"GET not after 404", http.MethodGet, "", []int{404}, 404, 1},
+		{"GET until retries run out", http.MethodGet, "", []int{500, 500, 500, 500, 500}, 500, 4},
+		{"POST after 429", http.MethodPost, "", []int{429}, 0, 2},
+		{"POST after 503 with Retry-After", http.MethodPost, "0", []int{503}, 0, 2},
+		{"POST not after 503 without Retry-After", http.MethodPost, "", []int{503}, 503, 1},
+		{"POST not after 500", http.MethodPost, "0", []int{500}, 500, 1},
+	}
+	for _, tt := range tests {
+		client, requests := newRetryClient(t, tt.retryAfter, tt.statuses...)
+		var body interface{}
+		if tt.method == http.MethodPost {
+			body = map[string]string{"text": "comment"}
+		}
+		err := client.doJSON(context.Background(), tt.method, client.BaseURL+"/rest/api/1.0/test", body, nil)
+
+		if got := statusCode(err); got != tt.wantErr || (tt.wantErr == 0 && err != nil) {
+			t.Errorf("%s: got error %v, want status %d", tt.name, err, tt.wantErr)
+		}
+		if got := atomic.LoadInt32(requests); got != tt.requests {
+			t.Errorf("%s: sent %d requests, want %d", tt.name, got, tt.requests)
+		}
+	}
+}
+
+func TestRetryAfterOverridesBackoff(t *testing.T) {
+	// The backoff alone would wait an hour
+	client, requests := newRetryClient(t, "0", 503)
+	client.Retry = RetryPolicy{MaxRetries: 1, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.getJSON(ctx, client.BaseURL+"/rest/api/1.0/test", nil); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("sent %d requests, want 2", got)
+	}
+}
+
+func TestRetryCancelledDuringBackoff(t *testing.T) {
+	client, requests := newRetryClient(t, "", 500)
+	client.Retry = RetryPolicy{MaxRetries: 1, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := client.getJSON(ctx, client.BaseURL+"/rest/api/1.0/test", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, want soon after cancellation", elapsed)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("sent %d requests, want 1", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	date := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+
+	tests := []struct {
+		value    string
+		min, max time.Duration
+		ok       bool
+	}{
+		{"", 0, 0, false},
+		{"120", 120 * time.Second, 120 * time.Second, true},
+		{"0", 0, 0, true},
+		{"-1", 0, 0, false},
+		{"soon", 0, 0, false},
+		{date, 28 * time.Second, 30 * time.Second, true},
+		{past, 0, 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if ok != tt.ok || got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v to %v, %v", tt.value, got, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
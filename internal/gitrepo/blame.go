@@ -0,0 +1,97 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UncommittedID is the commit ID git blame reports for lines of a working
+// tree that have not been committed
+const UncommittedID = "0000000000000000000000000000000000000000"
+
+// Blame returns the commit that last changed each line of a file, indexed by
+// line number minus one. An empty rev blames the file in the working tree.
+func (r *Repo) Blame(ctx context.Context, rev, path string) ([]CommitInfo, error) {
+	args := []string{"blame", "--porcelain"}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--", path)
+
+	out, err := r.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(out)
+}
+
+// parseBlame parses git blame --porcelain output. Each line of the file is
+// preceded by a header naming its commit; the commit's author fields follow
+// only the first time the commit appears.
+func parseBlame(out []byte) ([]CommitInfo, error) {
+	commits := make(map[string]*CommitInfo)
+	var lines []CommitInfo
+	var current *CommitInfo
+	finalLine := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// The content of the line ends each entry
+		if strings.HasPrefix(line, "\t") {
+			if current == nil || finalLine < 1 {
+				return nil, fmt.Errorf("unexpected git blame output")
+			}
+			for len(lines) < finalLine {
+				lines = append(lines, CommitInfo{})
+			}
+			lines[finalLine-1] = *current
+			current = nil
+			continue
+		}
+
+		if current == nil {
+			// Header: <commit> <original line> <final line> [<lines in group>]
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				return nil, fmt.Errorf("unexpected git blame header %q", line)
+			}
+			n, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected git blame header %q", line)
+			}
+			finalLine = n
+
+			current = commits[fields[0]]
+			if current == nil {
+				current = &CommitInfo{ID: fields[0]}
+				commits[fields[0]] = current
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.AuthorName = value
+		case "author-mail":
+			current.AuthorEmail = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.Date = time.Unix(seconds, 0).UTC()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
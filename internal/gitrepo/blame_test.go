@@ -0,0 +1,75 @@
+package gitrepo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	blameFirst  = "1111111111111111111111111111111111111111"
+	blameSecond = "2222222222222222222222222222222222222222"
+)
+
+// blameOutput joins lines of git blame --porcelain output
+func blameOutput(lines ...string) []byte {
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func TestParseBlame(t *testing.T) {
+	first := CommitInfo{ID: blameFirst, AuthorName: "Ada Lovelace", AuthorEmail: "ada@example.com", Date: time.Unix(1700000000, 0).UTC()}
+	second := CommitInfo{ID: blameSecond, AuthorName: "Alan Turing", AuthorEmail: "alan@example.com", Date: time.Unix(1700003600, 0).UTC()}
+	uncommitted := CommitInfo{ID: UncommittedID, AuthorName: "Not Committed Yet", AuthorEmail: "not.committed.yet"}
+
+	tests := []struct {
+		name    string
+		out     []byte
+		want    []CommitInfo
+		wantErr bool
+	}{
+		{"empty file", nil, nil, false},
+		{"commit details only on first appearance", blameOutput(
+			blameFirst+" 1 1 2",
+			"author Ada Lovelace",
+			"author-mail <ada@example.com>",
+			"author-time 1700000000",
+			"author-tz +0000",
+			"summary Add configuration",
+			"filename config.yml",
+			"\thost: db",
+			blameFirst+" 2 2",
+			"\tport: 5432",
+			blameSecond+" 2 3 1",
+			"author Alan Turing",
+			"author-mail <alan@example.com>",
+			"author-time 1700003600",
+			"previous "+blameFirst+" config.yml",
+			"filename config.yml",
+			"\tpassword: secret",
+			blameFirst+" 3 4 1",
+			"\t",
+		), []CommitInfo{first, first, second, first}, false},
+		{"uncommitted lines", blameOutput(
+			UncommittedID+" 1 1 1",
+			"author Not Committed Yet",
+			"author-mail <not.committed.yet>",
+			"author-time not-a-number",
+			"filename config.yml",
+			"\tnew line",
+		), []CommitInfo{uncommitted}, false},
+		{"short commit ID", blameOutput("1111111 1 1 1", "\tline"), nil, true},
+		{"bad line number", blameOutput(blameFirst+" 1 x 1", "\tline"), nil, true},
+		{"content without header", blameOutput("\tline"), nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseBlame(tt.out)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repo is a local git repository accessed through the git command line
+type Repo struct {
+	Dir string
+	env []string
+}
+
+// CommitInfo describes a commit
+type CommitInfo struct {
+	ID          string
+	AuthorName  string
+	AuthorEmail string
+	Date        time.Time
+	Parents     []string
+}
+
+// TreeEntry is a file in the tree of a commit
+type TreeEntry struct {
+	Path   string
+	BlobID string
+	Size   int64
+}
+
+// BearerAuth returns an HTTP Authorization header value for a bearer token
+func BearerAuth(token string) string {
+	return "Bearer " + token
+}
+
+// BasicAuth returns an HTTP Authorization header value for a username and password
+func BasicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// Clone clones url into dir as a bare repository. When authHeader is not
+// empty it is sent as the Authorization header of every HTTP request; it is
+// passed through the environment so it does not appear in process listings.
+func Clone(ctx context.Context, url, dir, authHeader string) (*Repo, error) {
+	repo := &Repo{
+		Dir: dir,
+		env: []string{"GIT_TERMINAL_PROMPT=0"},
+	}
+	if authHeader != "" {
+		repo.env = append(repo.env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: "+authHeader,
+		)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--bare", "--quiet", "--", url, dir)
+	cmd.Env = append(os.Environ(), repo.env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git clone: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return repo, nil
+}
+
+// Open opens an existing local repository, bare or not
+func Open(dir string) *Repo {
+	return &Repo{
+		Dir: dir,
+		env: []string{"GIT_TERMINAL_PROMPT=0"},
+	}
+}
+
+// git runs a git command in the repository and returns its standard output
+func (r *Repo) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), r.env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// RemoteURL returns the URL of a remote, such as "origin"
+func (r *Repo) RemoteURL(ctx context.Context, name string) (string, error) {
+	out, err := r.git(ctx, "remote", "get-url", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ResolveCommit resolves a revision such as a branch, tag or abbreviated ID to a full commit ID
+func (r *Repo) ResolveCommit(ctx context.Context, rev string) (string, error) {
+	out, err := r.git(ctx, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GetCommit fetches information about a commit
+func (r *Repo) GetCommit(ctx context.Context, commitID string) (CommitInfo, error) {
+	var info CommitInfo
+
+	out, err := r.git(ctx, "show", "-s", "--format=%H%x00%an%x00%ae%x00%aI%x00%P", commitID, "--")
+	if err != nil {
+		return info, err
+	}
+
+	fields := strings.Split(strings.TrimRight(string(out), "\n"), "\x00")
+	if len(fields) != 5 {
+		return info, fmt.Errorf("unexpected git show output for %s", commitID)
+	}
+
+	info.ID = fields[0]
+	info.AuthorName = fields[1]
+	info.AuthorEmail = fields[2]
+	info.Date, _ = time.Parse(time.RFC3339, fields[3])
+	info.Parents = strings.Fields(fields[4])
+
+	return info, nil
+}
+
+// ListTree lists every regular file in the tree of a commit. Symbolic links
+// and submodules are left out.
+func (r *Repo) ListTree(ctx context.Context, commitID string) ([]TreeEntry, error) {
+	out, err := r.git(ctx, "ls-tree", "-r", "-z", "--long", commitID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TreeEntry
+	for _, record := range strings.Split(string(out), "\x00") {
+		if record == "" {
+			continue
+		}
+
+		// Each record is "<mode> <type> <object> <size>\t<path>"
+		tab := strings.IndexByte(record, '\t')
+		if tab < 0 {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", record)
+		}
+		fields := strings.Fields(record[:tab])
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", record)
+		}
+		mode, objectType := fields[0], fields[1]
+		if objectType != "blob" || mode == "120000" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git ls-tree size %q", fields[3])
+		}
+
+		entries = append(entries, TreeEntry{
+			Path:   record[tab+1:],
+			BlobID: fields[2],
+			Size:   size,
+		})
+	}
+
+	return entries, nil
+}
+
+// BlobReader reads blob contents through a long-running git cat-file process
+type BlobReader struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// OpenBlobs starts a BlobReader. The caller must close it.
+func (r *Repo) OpenBlobs(ctx context.Context) (*BlobReader, error) {
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "--batch")
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), r.env...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &BlobReader{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// Read returns the content of a blob
+func (b *BlobReader) Read(blobID string) ([]byte, error) {
+	if _, err := fmt.Fprintln(b.stdin, blobID); err != nil {
+		return nil, err
+	}
+
+	// The header is "<object> <type> <size>" or "<object> missing"
+	header, err := b.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("git cat-file: %s", strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: unexpected header %q", header)
+	}
+
+	// The content is followed by a newline
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(b.stdout, content); err != nil {
+		return nil, err
+	}
+	return content[:size], nil
+}
+
+// Close stops the cat-file process
+func (b *BlobReader) Close() error {
+	b.stdin.Close()
+	return b.cmd.Wait()
+}
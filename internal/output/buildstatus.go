@@ -0,0 +1,68 @@
+package output
+
+import (
+	"context"
+	"fmt"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/internal/scanner"
+)
+
+// BuildStatusPublisher reports scan results as a commit build status, so that
+// merge checks requiring a successful build block commits with secrets
+type BuildStatusPublisher struct {
+	client    *bitbucket.Client
+	key       string
+	threshold float64
+	link      string
+}
+
+// NewBuildStatusPublisher creates a publisher that writes the build status with
+// the given key. The build fails when a secret has a confidence of at least
+// threshold. link is the report URL shown on the status; when empty, the
+// status links to the commit page.
+func NewBuildStatusPublisher(client *bitbucket.Client, key string, threshold float64, link string) *BuildStatusPublisher {
+	return &BuildStatusPublisher{
+		client:    client,
+		key:       key,
+		threshold: threshold,
+		link:      link,
+	}
+}
+
+// Publish sets the build status of a commit to SUCCESSFUL or FAILED and
+// returns the state that was set
+func (p *BuildStatusPublisher) Publish(ctx context.Context, projectKey, repoSlug, commitID string, secrets []scanner.Secret) (string, error) {
+	failing := 0
+	for _, secret := range secrets {
+		if secret.Confidence >= p.threshold {
+			failing++
+		}
+	}
+
+	state := "SUCCESSFUL"
+	description := "No secrets were found."
+	if failing > 0 {
+		state = "FAILED"
+		description = fmt.Sprintf("%d possible secrets were found.", failing)
+	} else if len(secrets) > 0 {
+		description = fmt.Sprintf("%d possible secrets were found below the failure threshold.", len(secrets))
+	}
+
+	link := p.link
+	if link == "" {
+		link = p.client.WebLinks().CommitURL(projectKey, repoSlug, commitID)
+	}
+
+	status := bitbucket.BuildStatus{
+		State:       state,
+		Key:         p.key,
+		Name:        "Secret scan",
+		URL:         link,
+		Description: description,
+	}
+	if err := p.client.SetBuildStatus(ctx, commitID, status); err != nil {
+		return "", fmt.Errorf("setting build status: %w", err)
+	}
+	return state, nil
+}
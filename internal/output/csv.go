@@ -4,10 +4,14 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"strings"
 
 	"bitbucket-secrets-scanner/internal/scanner"
 )
 
+// secretHeader is the header row of the secrets CSV
+var secretHeader = []string{"project_key", "repository_slug", "commit_id", "commit_date", "commit_author", "filename", "line_number", "end_line", "secret_type", "secret_value", "refs", "web_url", "column", "rule_id"}
+
 // CSVWriter handles writing scan results to a CSV file
 type CSVWriter struct {
 	file   *os.File
@@ -23,9 +27,8 @@ func NewCSVWriter(filePath string) (*CSVWriter, error) {
 
 	writer := csv.NewWriter(file)
 
-	// Write header - added end_line for multi-line secrets
-	header := []string{"project_key", "repository_slug", "commit_id", "commit_date", "commit_author", "filename", "line_number", "end_line", "secret_type", "secret_value"}
-	if err := writer.Write(header); err != nil {
+	// Write header
+	if err := writer.Write(secretHeader); err != nil {
 		file.Close()
 		return nil, err
 	}
@@ -40,25 +43,7 @@ func NewCSVWriter(filePath string) (*CSVWriter, error) {
 // WriteSecrets writes secrets to the CSV file
 func (w *CSVWriter) WriteSecrets(secrets []scanner.Secret) error {
 	for _, secret := range secrets {
-		// Include the end_line field for multi-line secrets
-		endLine := ""
-		if secret.EndLine > 0 && secret.EndLine != secret.LineNumber {
-			endLine = fmt.Sprintf("%d", secret.EndLine)
-		}
-
-		row := []string{
-			secret.ProjectKey,
-			secret.RepositorySlug,
-			secret.CommitID,
-			secret.CommitDate,
-			secret.CommitAuthor,
-			secret.Filename,
-			fmt.Sprintf("%d", secret.LineNumber),
-			endLine,
-			secret.SecretType,
-			secret.SecretValue,
-		}
-		if err := w.writer.Write(row); err != nil {
+		if err := w.writer.Write(secretRow(secret)); err != nil {
 			return err
 		}
 	}
@@ -67,8 +52,84 @@ func (w *CSVWriter) WriteSecrets(secrets []scanner.Secret) error {
 	return w.writer.Error()
 }
 
+// secretRow converts a secret to a CSV row
+func secretRow(secret scanner.Secret) []string {
+	// Include the end_line field for multi-line secrets
+	endLine := ""
+	if secret.EndLine > 0 && secret.EndLine != secret.LineNumber {
+		endLine = fmt.Sprintf("%d", secret.EndLine)
+	}
+
+	column := ""
+	if secret.Column > 0 {
+		column = fmt.Sprintf("%d", secret.Column)
+	}
+
+	return []string{
+		secret.ProjectKey,
+		secret.RepositorySlug,
+		secret.CommitID,
+		secret.CommitDate,
+		secret.CommitAuthor,
+		secret.Filename,
+		fmt.Sprintf("%d", secret.LineNumber),
+		endLine,
+		secret.SecretType,
+		secret.SecretValue,
+		strings.Join(secret.Refs, ";"),
+		secret.WebURL,
+		column,
+		secret.RuleID,
+	}
+}
+
 // Close closes the CSV file
 func (w *CSVWriter) Close() error {
 	w.writer.Flush()
 	return w.file.Close()
 }
+
+// WriteSkippedFiles writes the files that were not scanned, with the reason for each, to a CSV file
+func WriteSkippedFiles(filePath string, skipped []scanner.SkippedFile) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"project_key", "repository_slug", "commit_id", "filename", "reason"}); err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		if err := writer.Write([]string{s.ProjectKey, s.RepositorySlug, s.CommitID, s.Filename, s.Reason}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteSuppressedSecrets writes the secrets that were suppressed, with the
+// reason for each, to a CSV file
+func WriteSuppressedSecrets(filePath string, secrets []scanner.Secret) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(append(append([]string(nil), secretHeader...), "suppressed_by")); err != nil {
+		return err
+	}
+	for _, secret := range secrets {
+		if err := writer.Write(append(secretRow(secret), secret.Suppressed)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,103 @@
+package output
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/internal/scanner"
+)
+
+// InsightsPublisher publishes scan results as a Bitbucket Code Insights report
+type InsightsPublisher struct {
+	client    *bitbucket.Client
+	reportKey string
+}
+
+// NewInsightsPublisher creates a publisher that writes the report with the given key
+func NewInsightsPublisher(client *bitbucket.Client, reportKey string) *InsightsPublisher {
+	return &InsightsPublisher{
+		client:    client,
+		reportKey: reportKey,
+	}
+}
+
+// Publish replaces the report on a commit with one that passes when there are
+// no secrets and fails otherwise, annotating each secret on its file and line.
+// Secret values are redacted in the annotations.
+func (p *InsightsPublisher) Publish(ctx context.Context, projectKey, repoSlug, commitID string, secrets []scanner.Secret) error {
+	result := "PASS"
+	details := "No secrets were found."
+	if len(secrets) > 0 {
+		result = "FAIL"
+		details = fmt.Sprintf("%d possible secrets were found. Revoke any real credentials and remove them from the repository.", len(secrets))
+	}
+
+	report := bitbucket.InsightReport{
+		Title:    "Secret scan",
+		Details:  details,
+		Result:   result,
+		Reporter: "bitbucket-secret-scanner",
+		Data: []bitbucket.InsightDataItem{
+			{Title: "Secrets found", Type: "NUMBER", Value: len(secrets)},
+		},
+	}
+
+	if err := p.client.PutInsightReport(ctx, projectKey, repoSlug, commitID, p.reportKey, report); err != nil {
+		return fmt.Errorf("publishing report: %w", err)
+	}
+	if err := p.client.DeleteInsightAnnotations(ctx, projectKey, repoSlug, commitID, p.reportKey); err != nil {
+		return fmt.Errorf("clearing annotations: %w", err)
+	}
+
+	annotations := make([]bitbucket.InsightAnnotation, 0, len(secrets))
+	for _, secret := range secrets {
+		if len(annotations) == bitbucket.MaxInsightAnnotations {
+			break
+		}
+		annotations = append(annotations, insightAnnotation(secret))
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	if err := p.client.AddInsightAnnotations(ctx, projectKey, repoSlug, commitID, p.reportKey, annotations); err != nil {
+		return fmt.Errorf("adding annotations: %w", err)
+	}
+	return nil
+}
+
+// insightAnnotation converts a secret to an annotation with a redacted message
+func insightAnnotation(secret scanner.Secret) bitbucket.InsightAnnotation {
+	// Several findings can be on the same line, so the ID covers the column
+	// and rule too
+	id := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%s\x00%s",
+		secret.Filename, secret.LineNumber, secret.Column, secret.RuleID, secret.SecretType)))
+
+	return bitbucket.InsightAnnotation{
+		ExternalID: hex.EncodeToString(id[:16]),
+		Path:       secret.Filename,
+		Line:       secret.LineNumber,
+		Message:    fmt.Sprintf("Possible %s: %s", secret.SecretType, scanner.RedactSecretValue(secret.SecretValue)),
+		Severity:   insightSeverity(secret),
+		Type:       "VULNERABILITY",
+		Link:       secret.WebURL,
+	}
+}
+
+// insightSeverity returns the severity set by the secret's rule, or maps its
+// confidence score to an annotation severity
+func insightSeverity(secret scanner.Secret) string {
+	switch {
+	case secret.Severity != "":
+		return secret.Severity
+	case secret.Confidence >= 80:
+		return "HIGH"
+	case secret.Confidence >= 65:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
@@ -0,0 +1,24 @@
+package output
+
+import (
+	"testing"
+
+	"bitbucket-secrets-scanner/internal/scanner"
+)
+
+func TestInsightAnnotationExternalID(t *testing.T) {
+	secret := scanner.Secret{Filename: "config.yml", LineNumber: 3, Column: 10, RuleID: "generic-password", SecretType: "Password"}
+	otherColumn, otherRule := secret, secret
+	otherColumn.Column = 30
+	otherRule.RuleID = "generic-api-key"
+
+	id := insightAnnotation(secret).ExternalID
+	if insightAnnotation(secret).ExternalID != id {
+		t.Error("the external ID of a finding is not stable")
+	}
+	for name, other := range map[string]scanner.Secret{"column": otherColumn, "rule": otherRule} {
+		if insightAnnotation(other).ExternalID == id {
+			t.Errorf("findings on the same line with a different %s have the same external ID %s", name, id)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package scanner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// AllowlistConfig suppresses matches, either of one rule or of every rule.
+// A match is suppressed when any of the conditions given holds, or when all
+// of them hold if Condition is AND.
+type AllowlistConfig struct {
+	Description string `json:"description,omitempty" toml:"description" yaml:"description"`
+	Condition   string `json:"condition,omitempty" toml:"condition" yaml:"condition"` // OR (default) or AND
+
+	// Regexes are matched against the secret, the whole regex match or the
+	// line, as chosen by RegexTarget (default secret)
+	Regexes     []string `json:"regexes,omitempty" toml:"regexes" yaml:"regexes"`
+	RegexTarget string   `json:"regex_target,omitempty" toml:"regex_target" yaml:"regex_target"`
+
+	Paths     []string `json:"paths,omitempty" toml:"paths" yaml:"paths"`             // Regexes matched against the file path
+	Globs     []string `json:"globs,omitempty" toml:"globs" yaml:"globs"`             // Globs matched against the file path, such as **/testdata/**
+	Commits   []string `json:"commits,omitempty" toml:"commits" yaml:"commits"`       // Commit IDs
+	Stopwords []string `json:"stopwords,omitempty" toml:"stopwords" yaml:"stopwords"` // Words that, as whole words of the secret, suppress it
+}
+
+// AllowMarker on a line, or on the line above, suppresses the secrets found on that line
+const AllowMarker = "secret-scanner:allow"
+
+// allowlist is a compiled allowlist
+type allowlist struct {
+	reason    string // Reported for the matches it suppresses
+	and       bool
+	target    string
+	regexes   []*regexp.Regexp
+	paths     []*regexp.Regexp
+	commits   map[string]bool // Lower case
+	stopwords [][]string      // Words of each stopword
+}
+
+// allowTarget is a match being checked against allowlists
+type allowTarget struct {
+	secret string
+	match  string
+	line   string
+	path   string
+	commit string
+}
+
+// compileAllowlists validates and compiles allowlists
+func compileAllowlists(configs []AllowlistConfig) ([]*allowlist, error) {
+	var allowlists []*allowlist
+	for i, config := range configs {
+		a, err := compileAllowlist(config)
+		if err != nil {
+			name := config.Description
+			if name == "" {
+				name = fmt.Sprintf("%d", i+1)
+			}
+			return nil, fmt.Errorf("allowlist %s: %w", name, err)
+		}
+		allowlists = append(allowlists, a)
+	}
+	return allowlists, nil
+}
+
+// compileAllowlist validates and compiles an allowlist
+func compileAllowlist(config AllowlistConfig) (*allowlist, error) {
+	a := &allowlist{target: strings.ToLower(config.RegexTarget), reason: "allowlist"}
+	if config.Description != "" {
+		a.reason = "allowlist: " + config.Description
+	}
+
+	switch strings.ToUpper(config.Condition) {
+	case "", "OR":
+	case "AND":
+		a.and = true
+	default:
+		return nil, fmt.Errorf("condition must be OR or AND")
+	}
+
+	switch a.target {
+	case "":
+		a.target = "secret"
+	case "secret", "match", "line":
+	default:
+		return nil, fmt.Errorf("regex_target must be secret, match or line")
+	}
+
+	for _, expr := range config.Regexes {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		a.regexes = append(a.regexes, regex)
+	}
+	for _, expr := range config.Paths {
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", expr, err)
+		}
+		a.paths = append(a.paths, regex)
+	}
+	for _, glob := range config.Globs {
+		regex, err := globRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("glob %q: %w", glob, err)
+		}
+		a.paths = append(a.paths, regex)
+	}
+	if len(config.Commits) > 0 {
+		a.commits = make(map[string]bool, len(config.Commits))
+		for _, commit := range config.Commits {
+			a.commits[strings.ToLower(commit)] = true
+		}
+	}
+	for _, stopword := range config.Stopwords {
+		stopwordWords := words(stopword)
+		if len(stopwordWords) == 0 {
+			return nil, fmt.Errorf("stopword %q has no letters or digits", stopword)
+		}
+		a.stopwords = append(a.stopwords, stopwordWords)
+	}
+
+	if len(a.regexes) == 0 && len(a.paths) == 0 && len(a.commits) == 0 && len(a.stopwords) == 0 {
+		return nil, fmt.Errorf("no regexes, paths, globs, commits or stopwords")
+	}
+	return a, nil
+}
+
+// locationDependent reports whether the allowlist depends on where a match is
+func (a *allowlist) locationDependent() bool {
+	return len(a.paths) > 0 || len(a.commits) > 0
+}
+
+// allows reports whether the allowlist suppresses a match
+func (a *allowlist) allows(t allowTarget) bool {
+	var checks []bool
+	if len(a.commits) > 0 {
+		checks = append(checks, a.commits[strings.ToLower(t.commit)])
+	}
+	if len(a.paths) > 0 {
+		checks = append(checks, anyMatch(a.paths, t.path))
+	}
+	if len(a.regexes) > 0 {
+		value := t.secret
+		switch a.target {
+		case "match":
+			value = t.match
+		case "line":
+			value = t.line
+		}
+		checks = append(checks, anyMatch(a.regexes, value))
+	}
+	if len(a.stopwords) > 0 {
+		checks = append(checks, containsStopword(words(t.secret), a.stopwords))
+	}
+
+	for _, ok := range checks {
+		if ok && !a.and {
+			return true
+		}
+		if !ok && a.and {
+			return false
+		}
+	}
+	return a.and
+}
+
+// words splits s into lower case words at characters other than letters and
+// digits, between letters and digits, and where a lower case letter is
+// followed by an upper case one, so "myTestKey_2" is my, test, key and 2.
+// Stopwords match whole words, so that "test" does not suppress a random
+// token that happens to contain "latest".
+func words(s string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(word) > 0 {
+			previous := word[len(word)-1]
+			if unicode.IsDigit(previous) != unicode.IsDigit(r) || unicode.IsLower(previous) && unicode.IsUpper(r) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// containsStopword reports whether the words of a secret contain the words of
+// any stopword, in a row
+func containsStopword(secretWords []string, stopwords [][]string) bool {
+	for _, stopword := range stopwords {
+		for i := 0; i+len(stopword) <= len(secretWords); i++ {
+			if equalWords(secretWords[i:i+len(stopword)], stopword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalWords reports whether two lists of words are the same
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// anyMatch reports whether any of the regexes matches s
+func anyMatch(regexes []*regexp.Regexp, s string) bool {
+	for _, regex := range regexes {
+		if regex.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp converts a path glob to a regular expression. "**" matches any
+// number of directories, "*" and "?" match within a path segment, and
+// character classes such as [a-z] are supported.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
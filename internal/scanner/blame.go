@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"context"
+	"log"
+
+	"bitbucket-secrets-scanner/internal/gitrepo"
+)
+
+// lineAuthor is the commit that last changed a line
+type lineAuthor struct {
+	commitID     string
+	commitDate   string
+	commitAuthor string
+}
+
+// attributeSecrets attributes each secret to the commit that last changed its
+// first line. Secrets on lines without blame keep their attribution.
+func attributeSecrets(secrets []Secret, lines []lineAuthor) {
+	for i := range secrets {
+		line := secrets[i].LineNumber
+		if line < 1 || line > len(lines) || lines[line-1].commitID == "" {
+			continue
+		}
+		secrets[i].CommitID = lines[line-1].commitID
+		secrets[i].CommitDate = lines[line-1].commitDate
+		secrets[i].CommitAuthor = lines[line-1].commitAuthor
+	}
+}
+
+// blameFile attributes secrets found in a Bitbucket file using the blame of
+// the file at the scanned commit
+func (s *BitbucketScanner) blameFile(ctx context.Context, fileInfo SecretFileInfo, secrets []Secret) {
+	blame, err := s.client.GetBlame(ctx, fileInfo.ProjectKey, fileInfo.RepositorySlug, fileInfo.CommitID, fileInfo.Filename)
+	if err != nil {
+		log.Printf("Warning: Error getting blame for %s: %v", fileInfo.Filename, err)
+		return
+	}
+
+	var lines []lineAuthor
+	for _, entry := range blame {
+		author := lineAuthor{
+			commitID:     entry.CommitHash,
+			commitDate:   formatTimestamp(entry.AuthorTimestamp),
+			commitAuthor: formatAuthor(entry.Author),
+		}
+		for line := entry.LineNumber; line < entry.LineNumber+entry.SpannedLines; line++ {
+			if line < 1 {
+				continue
+			}
+			for len(lines) < line {
+				lines = append(lines, lineAuthor{})
+			}
+			lines[line-1] = author
+		}
+	}
+
+	attributeSecrets(secrets, lines)
+}
+
+// blameGitFile attributes secrets found in a file of a local repository using
+// git blame at rev, or in the working tree when rev is empty. Lines that are
+// not committed yet keep their attribution.
+func blameGitFile(ctx context.Context, repo *gitrepo.Repo, rev, path string, secrets []Secret) {
+	commits, err := repo.Blame(ctx, rev, path)
+	if err != nil {
+		log.Printf("Warning: Error getting blame for %s: %v", path, err)
+		return
+	}
+
+	lines := make([]lineAuthor, len(commits))
+	for i, commit := range commits {
+		if commit.ID == "" || commit.ID == gitrepo.UncommittedID {
+			continue
+		}
+		commitAuthor := commit.AuthorName
+		if commit.AuthorEmail != "" {
+			commitAuthor += " <" + commit.AuthorEmail + ">"
+		}
+		lines[i] = lineAuthor{
+			commitID:     commit.ID,
+			commitDate:   commit.Date.UTC().Format("2006-01-02 15:04:05"),
+			commitAuthor: commitAuthor,
+		}
+	}
+
+	attributeSecrets(secrets, lines)
+}
@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// fullCommitID matches a complete commit ID. Files are only cached by location
+// at full commit IDs, since branch names move.
+var fullCommitID = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// ScanCache is an on-disk cache of fetched file contents and detector
+// results, shared by scans of any commit or repository. Contents are stored
+// by their SHA-256 hash and detector results by content hash and rule-set
+// fingerprint, so results are reused only while neither the file nor the
+// rules change.
+//
+// The cache layout under its directory is:
+//
+//	files/<location hash>                content hash of a file at a commit
+//	content/<content hash>               file content
+//	results/<rules>/<content hash>.json  detector results
+type ScanCache struct {
+	dir string
+}
+
+// OpenScanCache opens the cache in dir, creating the directory if needed
+func OpenScanCache(dir string) (*ScanCache, error) {
+	for _, sub := range []string{"files", "content", "results"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	return &ScanCache{dir: dir}, nil
+}
+
+// contentHash returns the key content is stored under
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// locationKey returns the key of a file at a commit of a repository. It is
+// empty when the commit is not a full commit ID.
+func locationKey(host string, fileInfo SecretFileInfo) string {
+	if !fullCommitID.MatchString(fileInfo.CommitID) {
+		return ""
+	}
+	return contentHash(strings.Join([]string{host, fileInfo.ProjectKey, fileInfo.RepositorySlug, fileInfo.CommitID, fileInfo.Filename}, "\x00"))
+}
+
+// content returns the cached content of a file at a commit
+func (c *ScanCache) content(location string) (string, bool) {
+	if c == nil || location == "" {
+		return "", false
+	}
+	hash, err := os.ReadFile(filepath.Join(c.dir, "files", location))
+	if err != nil {
+		return "", false
+	}
+	content, err := os.ReadFile(filepath.Join(c.dir, "content", string(hash)))
+	if err != nil || contentHash(string(content)) != string(hash) {
+		// A missing or damaged entry is fetched again
+		return "", false
+	}
+	return string(content), true
+}
+
+// putContent stores the content of a file at a commit
+func (c *ScanCache) putContent(location, content string) error {
+	if c == nil || location == "" {
+		return nil
+	}
+	hash := contentHash(content)
+	if err := c.write(filepath.Join(c.dir, "content", hash), []byte(content)); err != nil {
+		return err
+	}
+	return c.write(filepath.Join(c.dir, "files", location), []byte(hash))
+}
+
+// scan returns the detector results for content, reusing cached results for
+// the same content and rules. A nil cache always scans.
+func (c *ScanCache) scan(detector *SecretDetector, content string, fileInfo SecretFileInfo) ([]Secret, error) {
+	if c == nil {
+		return scanText(detector, content, fileInfo)
+	}
+
+	path := filepath.Join(c.dir, "results", detector.Fingerprint(), detector.resultKey(contentHash(content), fileInfo)+".json")
+	if data, err := os.ReadFile(path); err == nil {
+		var cached []Secret
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return stampSecrets(cached, fileInfo), nil
+		}
+	}
+
+	secrets, err := scanText(detector, content, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(secrets)
+	if err == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err == nil {
+			c.write(path, data)
+		}
+	}
+	return secrets, nil
+}
+
+// write replaces a cache file atomically, so concurrent scans never read a
+// partly written entry
+func (c *ScanCache) write(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// stampSecrets attributes results found in one copy of some content to the
+// file described by fileInfo
+func stampSecrets(secrets []Secret, fileInfo SecretFileInfo) []Secret {
+	for i := range secrets {
+		secrets[i].ProjectKey = fileInfo.ProjectKey
+		secrets[i].RepositorySlug = fileInfo.RepositorySlug
+		secrets[i].CommitID = fileInfo.CommitID
+		secrets[i].CommitDate = fileInfo.CommitDate
+		secrets[i].CommitAuthor = fileInfo.CommitAuthor
+		secrets[i].Filename = fileInfo.Filename
+		secrets[i].Refs = nil
+		secrets[i].WebURL = ""
+	}
+	return secrets
+}
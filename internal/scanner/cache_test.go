@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bitbucket-secrets-scanner/pkg/bbtest"
+)
+
+const cachedFile = "host: db\npassword: \"h7Jk2pQz9Lx4Vb8N\"\n"
+
+// rawRequests counts the file content requests a fake server received
+func rawRequests(srv *bbtest.Server) int {
+	n := 0
+	for _, request := range srv.Requests() {
+		if strings.Contains(request, "/raw/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestScanCacheSkipsFetch(t *testing.T) {
+	cache, err := OpenScanCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, first := newTestScanner(t)
+	app := srv.AddRepository("PRJ", "app")
+	commitID := app.Commit("main", bbtest.Change{Message: "Add configuration", Files: map[string]string{"config.yml": cachedFile}})
+
+	first.SetCache(cache)
+	want, err := first.ScanCommit(context.Background(), "PRJ", "app", commitID)
+	if err != nil {
+		t.Fatalf("ScanCommit: %v", err)
+	}
+	fetched := rawRequests(srv)
+	if len(want) != 1 || fetched != 1 {
+		t.Fatalf("found %d secrets with %d file requests, want 1 with 1", len(want), fetched)
+	}
+
+	second := NewBitbucketScanner(first.client, NewSecretDetector())
+	second.SetCache(cache)
+	got, err := second.ScanCommit(context.Background(), "PRJ", "app", commitID)
+	if err != nil {
+		t.Fatalf("ScanCommit: %v", err)
+	}
+	if n := rawRequests(srv) - fetched; n != 0 {
+		t.Errorf("the cached scan requested %d files, want 0", n)
+	}
+	if len(got) != 1 || got[0].LineNumber != want[0].LineNumber || got[0].CommitID != commitID {
+		t.Errorf("the cached scan found %+v, want %+v", got, want)
+	}
+}
+
+// cachedResults returns the paths of every detector results file in a cache
+func cachedResults(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "results", "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestScanCacheFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenScanCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector := NewSecretDetector()
+	fileInfo := SecretFileInfo{Filename: "config.yml"}
+	if _, err := cache.scan(detector, cachedFile, fileInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	// Results read back from the cache are recognizable by being empty
+	paths := cachedResults(t, dir)
+	if len(paths) != 1 {
+		t.Fatalf("cached %d results, want 1", len(paths))
+	}
+	if err := os.WriteFile(paths[0], []byte("[]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if secrets, _ := cache.scan(detector, cachedFile, fileInfo); len(secrets) != 0 {
+		t.Errorf("the same rules found %d secrets, want the cached results", len(secrets))
+	}
+
+	set := DefaultRuleSet()
+	set.Rules = set.Rules[1:]
+	other, err := NewSecretDetectorWithRules(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets, _ := cache.scan(other, cachedFile, fileInfo); len(secrets) != 1 {
+		t.Errorf("other rules found %d secrets, want 1 from a new scan", len(secrets))
+	}
+}
+
+func TestScanCacheDamagedEntries(t *testing.T) {
+	const commitID = "0123456789abcdef0123456789abcdef01234567"
+	fileInfo := SecretFileInfo{ProjectKey: "PRJ", RepositorySlug: "app", CommitID: commitID, Filename: "config.yml"}
+	location := locationKey("https://bitbucket.example.com", fileInfo)
+
+	for _, damaged := range []string{"", "{not json", `[{"file":`} {
+		dir := t.TempDir()
+		cache, err := OpenScanCache(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Results
+		if _, err := cache.scan(NewSecretDetector(), cachedFile, fileInfo); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range cachedResults(t, dir) {
+			if err := os.WriteFile(path, []byte(damaged), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if secrets, err := cache.scan(NewSecretDetector(), cachedFile, fileInfo); err != nil || len(secrets) != 1 {
+			t.Errorf("results %q: found %d secrets (error %v), want 1 from a new scan", damaged, len(secrets), err)
+		}
+
+		// Content
+		if err := cache.putContent(location, cachedFile); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "content", contentHash(cachedFile)), []byte(damaged), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if content, ok := cache.content(location); ok {
+			t.Errorf("content %q: got cached content %q, want a miss", damaged, content)
+		}
+	}
+
+	// A location whose content is gone
+	dir := t.TempDir()
+	cache, err := OpenScanCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.putContent(location, cachedFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "content", contentHash(cachedFile))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.content(location); ok {
+		t.Error("got cached content for a location whose content was removed, want a miss")
+	}
+}
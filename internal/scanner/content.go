@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"bitbucket-secrets-scanner/pkg/util"
+)
+
+// DefaultMaxFileSize is the largest file scanned unless a scanner is configured otherwise
+const DefaultMaxFileSize = 10 << 20
+
+// SkippedFile records a file that was not scanned and why
+type SkippedFile struct {
+	ProjectKey     string `json:"project_key"`
+	RepositorySlug string `json:"repository_slug"`
+	CommitID       string `json:"commit_id"`
+	Filename       string `json:"filename"`
+	Reason         string `json:"reason"`
+}
+
+// skipList collects the files a scanner skipped
+type skipList struct {
+	skipped []SkippedFile
+}
+
+// skip records that a file was not scanned
+func (l *skipList) skip(fileInfo SecretFileInfo, reason string) {
+	log.Printf("Skipping %s: %s", fileInfo.Filename, reason)
+	l.skipped = append(l.skipped, SkippedFile{
+		ProjectKey:     fileInfo.ProjectKey,
+		RepositorySlug: fileInfo.RepositorySlug,
+		CommitID:       fileInfo.CommitID,
+		Filename:       fileInfo.Filename,
+		Reason:         reason,
+	})
+}
+
+// Skipped returns the files that were not scanned, with the reason for each
+func (l *skipList) Skipped() []SkippedFile {
+	return l.skipped
+}
+
+// suppressList collects the secrets a scanner suppressed
+type suppressList struct {
+	suppressed []Secret
+}
+
+// keep returns the secrets that were not suppressed, recording the others
+func (l *suppressList) keep(secrets []Secret) []Secret {
+	var kept []Secret
+	for _, secret := range secrets {
+		if secret.Suppressed != "" {
+			l.suppressed = append(l.suppressed, secret)
+			continue
+		}
+		kept = append(kept, secret)
+	}
+	return kept
+}
+
+// Suppressed returns the secrets that allowlists or inline markers
+// suppressed, with the reason for each
+func (l *suppressList) Suppressed() []Secret {
+	return l.suppressed
+}
+
+// readScannable reads content that is to be scanned. When the content is
+// binary or larger than maxSize it returns a reason for skipping it instead,
+// reading no more than maxSize bytes. contentType and size may be empty and
+// -1 when unknown; maxSize <= 0 disables the size limit.
+func readScannable(r io.Reader, contentType string, size, maxSize int64) (string, string, error) {
+	if util.IsBinaryContentType(contentType) {
+		return "", fmt.Sprintf("binary content type %s", contentType), nil
+	}
+	if maxSize > 0 && size > maxSize {
+		return "", fmt.Sprintf("file size %d bytes exceeds the %d byte limit", size, maxSize), nil
+	}
+
+	reader := bufio.NewReaderSize(r, util.SniffLen)
+	head, err := reader.Peek(util.SniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", "", err
+	}
+	if util.IsBinary(head) {
+		return "", "binary content", nil
+	}
+
+	var limited io.Reader = reader
+	if maxSize > 0 {
+		limited = io.LimitReader(reader, maxSize+1)
+	}
+	content, err := ioutil.ReadAll(limited)
+	if err != nil {
+		return "", "", err
+	}
+	if maxSize > 0 && int64(len(content)) > maxSize {
+		return "", fmt.Sprintf("file size exceeds the %d byte limit", maxSize), nil
+	}
+
+	return string(content), "", nil
+}
+
+// newLineScanner returns a line scanner over content that accepts lines of
+// any length, so minified files do not abort the scan
+func newLineScanner(content string) *bufio.Scanner {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	return scanner
+}
@@ -1,22 +1,200 @@
 package scanner
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"math"
-	"regexp"
 	"strings"
 )
 
+// detectorVersion changes whenever the detection logic changes in a way that
+// invalidates cached scan results
+const detectorVersion = "6"
+
 // SecretDetector contains the logic to detect secrets
 type SecretDetector struct {
-	patterns map[string]*regexp.Regexp
+	rules      []*compiledRule
+	allowlists []*allowlist
+	set        RuleSet
+
+	// fingerprint identifies the rule set, computed once since the rules do
+	// not change after the detector is created
+	fingerprint string
+
+	// prefilter finds the keywords and literal prefixes of the rules on a
+	// line, so that only rules which can match are evaluated.
+	// literalRules lists the rules of each literal, and unfiltered marks the
+	// rules to evaluate on every line. Rules filtered on literal prefixes
+	// are also evaluated on every non-ASCII line, where case folding is not
+	// limited to ASCII. A nil prefilter evaluates every rule whose keywords
+	// are on the line.
+	prefilter    *keywordMatcher
+	literalRules [][]int
+	unfiltered   []bool
+	derived      []bool
+
+	// locationDependent is set when some rule or allowlist only applies to
+	// certain paths or commits, so identical content elsewhere can give
+	// different results
+	locationDependent bool
 }
 
-// NewSecretDetector creates a new secret detector with predefined patterns
+// NewSecretDetector creates a new secret detector with the built-in rules
 func NewSecretDetector() *SecretDetector {
-	return &SecretDetector{
-		patterns: getSecretPatterns(),
+	detector, err := NewSecretDetectorWithRules(DefaultRuleSet())
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in rules: %v", err))
+	}
+	return detector
+}
+
+// NewSecretDetectorWithRules creates a secret detector that evaluates the
+// rules of set in order
+func NewSecretDetectorWithRules(set RuleSet) (*SecretDetector, error) {
+	rules, err := compileRules(set.Rules)
+	if err != nil {
+		return nil, err
+	}
+	allowlists, err := compileAllowlists(set.Allowlists)
+	if err != nil {
+		return nil, err
+	}
+
+	detector := &SecretDetector{rules: rules, allowlists: allowlists, set: set}
+	detector.buildPrefilter()
+	detector.fingerprint = fingerprintRuleSet(set)
+	for _, a := range allowlists {
+		detector.locationDependent = detector.locationDependent || a.locationDependent()
+	}
+	for _, r := range rules {
+		detector.locationDependent = detector.locationDependent || len(r.paths) > 0
+		for _, a := range r.allowlists {
+			detector.locationDependent = detector.locationDependent || a.locationDependent()
+		}
+	}
+	return detector, nil
+}
+
+// buildPrefilter builds the keyword matcher over the literals of every rule
+func (d *SecretDetector) buildPrefilter() {
+	d.unfiltered = make([]bool, len(d.rules))
+	d.derived = make([]bool, len(d.rules))
+
+	var literals []string
+	index := make(map[string]int)
+	for i, r := range d.rules {
+		ruleLiterals := prefilterLiterals(r)
+		if len(ruleLiterals) == 0 {
+			d.unfiltered[i] = true
+			continue
+		}
+		d.derived[i] = len(r.keywords) == 0
+		for _, literal := range ruleLiterals {
+			j, ok := index[literal]
+			if !ok {
+				j = len(literals)
+				index[literal] = j
+				literals = append(literals, literal)
+				d.literalRules = append(d.literalRules, nil)
+			}
+			d.literalRules[j] = append(d.literalRules[j], i)
+		}
+	}
+	d.prefilter = newKeywordMatcher(literals)
+}
+
+// candidates returns which rules can match line
+func (d *SecretDetector) candidates(line string) []bool {
+	candidates := make([]bool, len(d.rules))
+	if d.prefilter == nil {
+		// Without a prefilter, every rule is evaluated unless it has
+		// keywords and none of them is on the line
+		lowerLine := strings.ToLower(line)
+		for i, r := range d.rules {
+			candidates[i] = len(r.keywords) == 0
+			for _, keyword := range r.keywords {
+				candidates[i] = candidates[i] || strings.Contains(lowerLine, keyword)
+			}
+		}
+		return candidates
+	}
+	copy(candidates, d.unfiltered)
+
+	text := line
+	if !isASCII(line) {
+		text = strings.ToLower(line)
+		for i, derived := range d.derived {
+			candidates[i] = candidates[i] || derived
+		}
+	}
+	d.prefilter.match(text, func(literal int) {
+		for _, i := range d.literalRules[literal] {
+			candidates[i] = true
+		}
+	})
+
+	for i, r := range d.rules {
+		if len(line) < r.minLength {
+			candidates[i] = false
+		}
+	}
+	return candidates
+}
+
+// Fingerprint identifies the detector's rule set. Cached scan results are
+// reused only by a detector with the same fingerprint.
+func (d *SecretDetector) Fingerprint() string {
+	return d.fingerprint
+}
+
+// fingerprintRuleSet hashes a rule set together with the detector version
+func fingerprintRuleSet(set RuleSet) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "version %s\n", detectorVersion)
+	json.NewEncoder(hash).Encode(set)
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// Rules returns the detector's rules in the order they are evaluated
+func (d *SecretDetector) Rules() []Rule {
+	rules := make([]Rule, len(d.rules))
+	for i, r := range d.rules {
+		rules[i] = r.Rule
+	}
+	return rules
+}
+
+// resultKey returns the key under which the results for content with the
+// given hash can be shared between files
+func (d *SecretDetector) resultKey(hash string, fileInfo SecretFileInfo) string {
+	if !d.locationDependent {
+		return hash
 	}
+	return contentHash(strings.Join([]string{hash, fileInfo.Filename, fileInfo.CommitID}, "\x00"))
+}
+
+// allowed returns why a match is suppressed by a global allowlist or, unless
+// r is nil, an allowlist of its rule. It returns "" if the match is not
+// suppressed.
+func (d *SecretDetector) allowed(r *compiledRule, secretValue, match, line string, fileInfo SecretFileInfo) string {
+	target := allowTarget{secret: secretValue, match: match, line: line, path: fileInfo.Filename, commit: fileInfo.CommitID}
+	for _, a := range d.allowlists {
+		if a.allows(target) {
+			return a.reason
+		}
+	}
+	if r == nil {
+		return ""
+	}
+	for _, a := range r.allowlists {
+		if a.allows(target) {
+			return "rule " + a.reason
+		}
+	}
+	return ""
 }
 
 // calculateEntropy calculates the Shannon entropy of a string
@@ -49,18 +227,6 @@ func calculateCharacterDiversity(s string) float64 {
 	return float64(len(unique)) / float64(len(s))
 }
 
-// isDictionaryWord checks if the string contains common test words
-func isDictionaryWord(s string) bool {
-	lower := strings.ToLower(s)
-	testWords := []string{"test", "example", "dummy", "fake", "not_a_real", "sample"}
-	for _, word := range testWords {
-		if strings.Contains(lower, word) {
-			return true
-		}
-	}
-	return false
-}
-
 // calculateConfidenceScore computes a confidence score for a secret
 func calculateConfidenceScore(secretValue, line string, isQuoted bool) float64 {
 	score := 0.0
@@ -97,11 +263,6 @@ func calculateConfidenceScore(secretValue, line string, isQuoted bool) float64 {
 		score += 10
 	}
 
-	// Dictionary word penalty (-20 points)
-	if isDictionaryWord(secretValue) {
-		score -= 20
-	}
-
 	// Length bonus (0–10 points)
 	if len(secretValue) > 20 {
 		score += 10
@@ -112,119 +273,171 @@ func calculateConfidenceScore(secretValue, line string, isQuoted bool) float64 {
 	return math.Max(0, math.Min(100, score))
 }
 
-// DetectSecrets scans a line for secrets
+// DetectSecrets scans a line for secrets. Secrets suppressed by an allowlist
+// are returned too, with the reason in Suppressed.
 func (d *SecretDetector) DetectSecrets(line string, lineNum int, fileInfo SecretFileInfo) []Secret {
 	var secrets []Secret
+	candidates := d.candidates(line)
 
-	// Define private key patterns to check first
-	privateKeyTypes := []string{
-		"Private Key",
-		"SSH Private Key",
-		"RSA Private Key",
-		"PGP Private Key",
-		"EC Private Key",
-	}
-
-	// Check for private keys first
-	for _, secretType := range privateKeyTypes {
-		if pattern, exists := d.patterns[secretType]; exists {
-			matches := pattern.FindAllStringSubmatch(line, -1)
-			for _, match := range matches {
-				secretValue := match[0]
-				if len(match) > 1 && match[1] != "" {
-					secretValue = match[1]
-				}
-				if len(secretValue) < 6 {
-					continue
-				}
-				confidence := calculateConfidenceScore(secretValue, line, false)
-				if confidence < 50 {
-					continue
-				}
-				secrets = append(secrets, Secret{
-					ProjectKey:     fileInfo.ProjectKey,
-					RepositorySlug: fileInfo.RepositorySlug,
-					CommitID:       fileInfo.CommitID,
-					CommitDate:     fileInfo.CommitDate,
-					CommitAuthor:   fileInfo.CommitAuthor,
-					Filename:       fileInfo.Filename,
-					LineNumber:     lineNum,
-					SecretType:     secretType,
-					SecretValue:    secretValue,
-					Confidence:     confidence,
-				})
-				return secrets
+	// Exclusive rules, such as private key headers, are checked first and
+	// the first match is the only finding on the line
+	for i, r := range d.rules {
+		if !r.Exclusive || !candidates[i] || !r.appliesToPath(fileInfo.Filename) {
+			continue
+		}
+		for _, match := range r.matches(line) {
+			if len(match.secret) < minSecretLength {
+				continue
+			}
+			confidence := calculateConfidenceScore(match.secret, line, false)
+			if confidence < r.minConfidence {
+				continue
 			}
+			secret := newSecret(r, match, confidence, lineNum, fileInfo)
+			if secret.Suppressed = d.allowed(r, match.secret, match.text, line, fileInfo); secret.Suppressed != "" {
+				secrets = append(secrets, secret)
+				continue
+			}
+			return append(secrets, secret)
 		}
 	}
 
-	// Check for Base64-encoded secrets
-	if pattern, exists := d.patterns["Base64 Potential"]; exists {
-		matches := pattern.FindAllStringSubmatch(line, -1)
-		for _, match := range matches {
-			encoded := match[0]
-			decoded, err := base64.StdEncoding.DecodeString(encoded)
-			if err == nil {
-				decodedLine := string(decoded)
-				// Recursively scan the decoded string
-				decodedSecrets := d.DetectSecrets(decodedLine, lineNum, fileInfo)
-				for i := range decodedSecrets {
-					decodedSecrets[i].SecretType = "Base64 Decoded " + decodedSecrets[i].SecretType
-				}
-				secrets = append(secrets, decodedSecrets...)
+	// Check for encoded secrets
+	for i, r := range d.rules {
+		if r.Decode == "" || !candidates[i] || !r.appliesToPath(fileInfo.Filename) {
+			continue
+		}
+		for _, match := range r.matches(line) {
+			decoded, err := base64.StdEncoding.DecodeString(match.secret)
+			if err != nil {
+				continue
+			}
+			// Recursively scan the decoded string. Findings keep the rule
+			// that matched the decoded text and the column of the encoded text.
+			decodedSecrets := d.DetectSecrets(string(decoded), lineNum, fileInfo)
+			for i := range decodedSecrets {
+				decodedSecrets[i].SecretType = "Base64 Decoded " + decodedSecrets[i].SecretType
+				decodedSecrets[i].Column = match.column
 			}
+			secrets = append(secrets, decodedSecrets...)
 		}
 	}
 
-	// Check other patterns
-	for secretType, pattern := range d.patterns {
-		isPrivateKey := false
-		for _, pkType := range privateKeyTypes {
-			if secretType == pkType || secretType == "Base64 Potential" {
-				isPrivateKey = true
-				break
-			}
-		}
-		if isPrivateKey {
+	// Check other rules
+	for i, r := range d.rules {
+		if r.Exclusive || r.Decode != "" || !candidates[i] || !r.appliesToPath(fileInfo.Filename) {
 			continue
 		}
 
-		matches := pattern.FindAllStringSubmatch(line, -1)
-		for _, match := range matches {
-			secretValue := match[0]
-			if len(match) > 1 && match[1] != "" {
-				secretValue = match[1]
-			}
-			if len(secretValue) < 6 {
+		for _, match := range r.matches(line) {
+			secretValue := match.secret
+			if len(secretValue) < minSecretLength {
 				continue
 			}
 
-			// Skip unquoted values with dots or code-like patterns unless in comments
-			if secretType != "Comment Secret" && !strings.ContainsAny(secretValue, "'\"") && strings.Contains(secretValue, ".") {
+			// Skip unquoted values with dots, which are usually code
+			if r.IgnoreDotted && !strings.ContainsAny(secretValue, "'\"") && strings.Contains(secretValue, ".") {
+				continue
+			}
+			if r.Entropy > 0 && calculateEntropy(secretValue) < r.Entropy {
 				continue
 			}
 
 			// Calculate confidence score
 			isQuoted := strings.HasPrefix(secretValue, "'") || strings.HasPrefix(secretValue, "\"")
 			confidence := calculateConfidenceScore(secretValue, line, isQuoted)
-			if confidence < 50 {
+			if confidence < r.minConfidence {
 				continue
 			}
 
-			secrets = append(secrets, Secret{
-				ProjectKey:     fileInfo.ProjectKey,
-				RepositorySlug: fileInfo.RepositorySlug,
-				CommitID:       fileInfo.CommitID,
-				CommitDate:     fileInfo.CommitDate,
-				CommitAuthor:   fileInfo.CommitAuthor,
-				Filename:       fileInfo.Filename,
-				LineNumber:     lineNum,
-				SecretType:     secretType,
-				SecretValue:    secretValue,
-				Confidence:     confidence,
-			})
+			secret := newSecret(r, match, confidence, lineNum, fileInfo)
+			secret.Suppressed = d.allowed(r, secretValue, match.text, line, fileInfo)
+			secrets = append(secrets, secret)
 		}
 	}
 
 	return secrets
 }
+
+// detectMultiline finds the secrets of rules with an end pattern, such as
+// private keys, which span from a line matching the rule to the next match of
+// its end pattern. It also returns the lines each secret covers, which are
+// not scanned again line by line.
+func (d *SecretDetector) detectMultiline(content string, fileInfo SecretFileInfo) ([]Secret, []Region) {
+	var rules []*compiledRule
+	candidates := d.candidates(content)
+	for i, r := range d.rules {
+		if r.end != nil && candidates[i] && r.appliesToPath(fileInfo.Filename) {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	var secrets []Secret
+	var regions []Region
+	lineNum := 0
+	for offset := 0; offset < len(content); {
+		lineNum++
+		lineEnd := strings.IndexByte(content[offset:], '\n')
+		next := offset + lineEnd + 1
+		if lineEnd < 0 {
+			lineEnd, next = len(content)-offset, len(content)
+		}
+		line := strings.TrimSuffix(content[offset:offset+lineEnd], "\r")
+
+		// The first rule whose secret ends somewhere claims the line
+		for _, r := range rules {
+			start := r.regex.FindStringIndex(line)
+			if start == nil {
+				continue
+			}
+			endMatch := r.end.FindStringIndex(content[offset+start[1]:])
+			if endMatch == nil {
+				continue
+			}
+			end := offset + start[1] + endMatch[1]
+			value := content[offset+start[0] : end]
+			confidence := calculateConfidenceScore(value, value, false)
+			if confidence < r.minConfidence {
+				continue
+			}
+
+			secret := newSecret(r, ruleMatch{secret: truncateSecretValue(value), column: start[0] + 1}, confidence, lineNum, fileInfo)
+			secret.EndLine = lineNum + strings.Count(value, "\n")
+			secret.Suppressed = d.allowed(r, value, value, value, fileInfo)
+			secrets = append(secrets, secret)
+			regions = append(regions, Region{StartLine: lineNum, EndLine: secret.EndLine})
+
+			// Continue after the line the secret ends on
+			next = len(content)
+			if i := strings.IndexByte(content[end:], '\n'); i >= 0 {
+				next = end + i + 1
+			}
+			lineNum = secret.EndLine
+			break
+		}
+		offset = next
+	}
+	return secrets, regions
+}
+
+// newSecret creates a finding for a rule match
+func newSecret(r *compiledRule, match ruleMatch, confidence float64, lineNum int, fileInfo SecretFileInfo) Secret {
+	return Secret{
+		ProjectKey:     fileInfo.ProjectKey,
+		RepositorySlug: fileInfo.RepositorySlug,
+		CommitID:       fileInfo.CommitID,
+		CommitDate:     fileInfo.CommitDate,
+		CommitAuthor:   fileInfo.CommitAuthor,
+		Filename:       fileInfo.Filename,
+		LineNumber:     lineNum,
+		Column:         match.column,
+		RuleID:         r.ID,
+		SecretType:     r.Description,
+		SecretValue:    match.secret,
+		Confidence:     confidence,
+		Severity:       r.Severity,
+	}
+}
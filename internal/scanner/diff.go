@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"strings"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+)
+
+// scanDiff scans only the lines a diff adds, reporting secrets at their line
+// numbers in the destination file
+func (s *BitbucketScanner) scanDiff(diff bitbucket.Diff, fileInfo SecretFileInfo) ([]Secret, error) {
+	var secrets []Secret
+
+	for _, hunk := range diff.Hunks {
+		// The last line before the segment in the destination file
+		previous := ""
+		for _, segment := range hunk.Segments {
+			if segment.Type == "REMOVED" || len(segment.Lines) == 0 {
+				continue
+			}
+			if segment.Type != "ADDED" {
+				previous = segment.Lines[len(segment.Lines)-1].Line
+				continue
+			}
+
+			// Lines in a segment are contiguous, so scan them as one block to
+			// keep multi-line private keys intact
+			lines := make([]string, len(segment.Lines))
+			for i, line := range segment.Lines {
+				lines[i] = line.Line
+			}
+
+			segmentSecrets, err := s.cache.scan(s.detector, strings.Join(lines, "\n"), fileInfo)
+			if err != nil {
+				return nil, err
+			}
+
+			// An allow marker on the line before the segment applies to its first line
+			if strings.Contains(previous, AllowMarker) {
+				for i := range segmentSecrets {
+					if segmentSecrets[i].LineNumber == 1 && segmentSecrets[i].Suppressed == "" {
+						segmentSecrets[i].Suppressed = "inline " + AllowMarker
+					}
+				}
+			}
+			previous = lines[len(lines)-1]
+
+			offset := segment.Lines[0].Destination - 1
+			for i := range segmentSecrets {
+				segmentSecrets[i].LineNumber += offset
+				if segmentSecrets[i].EndLine > 0 {
+					segmentSecrets[i].EndLine += offset
+				}
+			}
+			secrets = append(secrets, s.keep(segmentSecrets)...)
+		}
+	}
+
+	return secrets, nil
+}
+
+// diffPath returns the path of the file a diff produces, or "" if the diff
+// deletes the file or has no scannable text
+func diffPath(diff bitbucket.Diff) string {
+	if diff.Binary || diff.Destination == nil {
+		return ""
+	}
+	return diff.Destination.ToString
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/internal/gitrepo"
+)
+
+// GitScanner scans commits of a local git repository, typically a bare clone
+// of a Bitbucket repository, reading objects directly instead of calling the
+// REST API once per file
+type GitScanner struct {
+	skipList
+	suppressList
+	repo           *gitrepo.Repo
+	detector       *SecretDetector
+	projectKey     string
+	repositorySlug string
+	maxFileSize    int64
+	blame          bool
+	cache          *ScanCache
+}
+
+// NewGitScanner creates a scanner for a local repository. projectKey and
+// repoSlug are recorded on every secret, as they would be for a REST scan.
+func NewGitScanner(repo *gitrepo.Repo, detector *SecretDetector, projectKey, repoSlug string) *GitScanner {
+	return &GitScanner{
+		repo:           repo,
+		detector:       detector,
+		projectKey:     projectKey,
+		repositorySlug: repoSlug,
+		maxFileSize:    DefaultMaxFileSize,
+	}
+}
+
+// SetMaxFileSize sets the largest file that is scanned; larger files are
+// skipped. A limit of 0 or less scans files of any size.
+func (s *GitScanner) SetMaxFileSize(limit int64) {
+	s.maxFileSize = limit
+}
+
+// SetBlame attributes each secret to the commit that last changed its line
+// instead of the scanned commit
+func (s *GitScanner) SetBlame(enabled bool) {
+	s.blame = enabled
+}
+
+// SetCache reuses the detector results cached for blobs with the same content
+func (s *GitScanner) SetCache(cache *ScanCache) {
+	s.cache = cache
+}
+
+// ScanCommit scans every file in the tree of rev, which may be a commit ID,
+// branch or tag. Files with the same blob ID are scanned only once, but the
+// findings of each copy are reported, or counted as suppressed, separately.
+func (s *GitScanner) ScanCommit(ctx context.Context, rev string) ([]Secret, error) {
+	commitID, err := s.repo.ResolveCommit(ctx, rev)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+
+	commit, err := s.repo.GetCommit(ctx, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit info: %w", err)
+	}
+
+	entries, err := s.repo.ListTree(ctx, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("getting file list: %w", err)
+	}
+
+	blobs, err := s.repo.OpenBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer blobs.Close()
+
+	// Findings link to the origin remote when it is a Bitbucket repository
+	remote, linked := s.remote(ctx)
+
+	resultsByBlob := make(map[string][]Secret)
+	var allSecrets []Secret
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return allSecrets, err
+		}
+
+		fileInfo := s.fileInfo(commit, entry.Path)
+
+		resultKey := s.detector.resultKey(entry.BlobID, fileInfo)
+		results, scanned := resultsByBlob[resultKey]
+		if !scanned {
+			if s.maxFileSize > 0 && entry.Size > s.maxFileSize {
+				s.skip(fileInfo, fmt.Sprintf("file size %d bytes exceeds the %d byte limit", entry.Size, s.maxFileSize))
+				continue
+			}
+
+			data, err := blobs.Read(entry.BlobID)
+			if err != nil {
+				return allSecrets, fmt.Errorf("reading %s: %w", entry.Path, err)
+			}
+
+			content, reason, err := readScannable(bytes.NewReader(data), "", entry.Size, s.maxFileSize)
+			if err != nil {
+				return allSecrets, err
+			}
+			if reason != "" {
+				s.skip(fileInfo, reason)
+				continue
+			}
+
+			results, err = s.cache.scan(s.detector, content, fileInfo)
+			if err != nil {
+				log.Printf("Warning: Error scanning file %s: %v", entry.Path, err)
+				continue
+			}
+			resultsByBlob[resultKey] = results
+		}
+
+		fileSecrets := make([]Secret, 0, len(results))
+		for _, result := range results {
+			secret := result
+			secret.Filename = fileInfo.Filename
+			if linked {
+				secret.WebURL = remote.Links.FileURL(remote.ProjectKey, remote.RepositorySlug, secret.CommitID, secret.Filename, secret.LineNumber)
+			}
+			fileSecrets = append(fileSecrets, secret)
+		}
+		fileSecrets = s.keep(fileSecrets)
+		if s.blame && len(fileSecrets) > 0 {
+			blameGitFile(ctx, s.repo, commitID, entry.Path, fileSecrets)
+		}
+		allSecrets = append(allSecrets, fileSecrets...)
+	}
+
+	return allSecrets, nil
+}
+
+// remote identifies the Bitbucket repository of the origin remote
+func (s *GitScanner) remote(ctx context.Context) (bitbucket.Remote, bool) {
+	remoteURL, err := s.repo.RemoteURL(ctx, "origin")
+	if err != nil {
+		return bitbucket.Remote{}, false
+	}
+	return bitbucket.ParseRemote(remoteURL)
+}
+
+// fileInfo builds the metadata attached to secrets found in a file of commit
+func (s *GitScanner) fileInfo(commit gitrepo.CommitInfo, path string) SecretFileInfo {
+	commitAuthor := commit.AuthorName
+	if commit.AuthorEmail != "" {
+		commitAuthor += " <" + commit.AuthorEmail + ">"
+	}
+
+	commitDate := ""
+	if !commit.Date.IsZero() {
+		commitDate = commit.Date.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	return SecretFileInfo{
+		ProjectKey:     s.projectKey,
+		RepositorySlug: s.repositorySlug,
+		CommitID:       commit.ID,
+		CommitDate:     commitDate,
+		CommitAuthor:   commitAuthor,
+		Filename:       path,
+	}
+}
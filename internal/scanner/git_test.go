@@ -0,0 +1,98 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"bitbucket-secrets-scanner/internal/gitrepo"
+)
+
+// runGit runs a git command in dir, failing the test if it fails
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Fixture Author", "GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_COMMITTER_NAME=Fixture Author", "GIT_COMMITTER_EMAIL=author@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+}
+
+// newBareRepo commits files to a new repository and clones it into a local
+// bare repository
+func newBareRepo(t *testing.T, files map[string]string) *gitrepo.Repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	work := t.TempDir()
+	runGit(t, work, "init", "--quiet")
+	for path, content := range files {
+		full := filepath.Join(work, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, work, "add", "-A")
+	runGit(t, work, "commit", "--quiet", "-m", "Add fixtures")
+
+	repo, err := gitrepo.Clone(context.Background(), "file://"+work, filepath.Join(t.TempDir(), "repo.git"), "")
+	if err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	return repo
+}
+
+func TestGitScannerScanCommit(t *testing.T) {
+	const (
+		secret     = "password = \"h7Jk2pQz9Lx4Vb8N\"\n"
+		suppressed = "password = \"Mn3Bv8Cx5Zl1Kj6H\" # secret-scanner:allow\n"
+	)
+	repo := newBareRepo(t, map[string]string{
+		"config/app.yml":   "host: db\n" + secret,
+		"config/copy.yml":  "host: db\n" + secret,
+		"docs/a.md":        suppressed,
+		"docs/b.md":        suppressed,
+		"-dashed name.txt": secret,
+		"logo.png":         "\x89PNG\r\n\x1a\n\x00\x00" + secret,
+	})
+
+	gitScanner := NewGitScanner(repo, NewSecretDetector(), "PRJ", "app")
+	secrets, err := gitScanner.ScanCommit(context.Background(), "HEAD")
+	if err != nil {
+		t.Fatalf("ScanCommit: %v", err)
+	}
+
+	byFile := foundIn(secrets)
+	for path, line := range map[string]int{"config/app.yml": 2, "config/copy.yml": 2, "-dashed name.txt": 1} {
+		found := byFile[path]
+		if len(found) != 1 || found[0].LineNumber != line || found[0].ProjectKey != "PRJ" || len(found[0].CommitID) != 40 {
+			t.Errorf("found %+v in %s, want one secret at line %d", found, path, line)
+		}
+	}
+	if len(secrets) != 3 {
+		t.Errorf("found %d secrets, want 3", len(secrets))
+	}
+
+	// Each copy of a blob is counted as suppressed
+	suppressedByFile := foundIn(gitScanner.Suppressed())
+	if len(suppressedByFile["docs/a.md"]) != 1 || len(suppressedByFile["docs/b.md"]) != 1 {
+		t.Errorf("suppressed %+v, want one secret in each of docs/a.md and docs/b.md", gitScanner.Suppressed())
+	}
+
+	skipped := gitScanner.Skipped()
+	if len(skipped) != 1 || skipped[0].Filename != "logo.png" {
+		t.Errorf("skipped %+v, want only logo.png", skipped)
+	}
+}
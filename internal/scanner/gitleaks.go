@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// maxGitleaksExtendDepth limits chains of [extend] path, as Gitleaks does
+const maxGitleaksExtendDepth = 2
+
+// gitleaksConfig is the part of the Gitleaks configuration schema that maps
+// onto a RuleSet. Other fields are reported as unsupported.
+type gitleaksConfig struct {
+	Title      string              `toml:"title"`
+	Extend     gitleaksExtend      `toml:"extend"`
+	Rules      []gitleaksRule      `toml:"rules"`
+	Allowlist  *gitleaksAllowlist  `toml:"allowlist"`
+	Allowlists []gitleaksAllowlist `toml:"allowlists"`
+}
+
+// gitleaksExtend is the [extend] table of a Gitleaks configuration
+type gitleaksExtend struct {
+	UseDefault    bool     `toml:"useDefault"`
+	Path          string   `toml:"path"`
+	DisabledRules []string `toml:"disabledRules"`
+}
+
+// gitleaksRule is a [[rules]] entry of a Gitleaks configuration
+type gitleaksRule struct {
+	ID          string              `toml:"id"`
+	Description string              `toml:"description"`
+	Regex       string              `toml:"regex"`
+	SecretGroup int                 `toml:"secretGroup"`
+	Entropy     float64             `toml:"entropy"`
+	Keywords    []string            `toml:"keywords"`
+	Path        string              `toml:"path"`
+	Tags        []string            `toml:"tags"`
+	Allowlist   *gitleaksAllowlist  `toml:"allowlist"`
+	Allowlists  []gitleaksAllowlist `toml:"allowlists"`
+}
+
+// gitleaksAllowlist is an allowlist of a Gitleaks configuration
+type gitleaksAllowlist struct {
+	Description string   `toml:"description"`
+	Condition   string   `toml:"condition"`
+	RegexTarget string   `toml:"regexTarget"`
+	Regexes     []string `toml:"regexes"`
+	Paths       []string `toml:"paths"`
+	Commits     []string `toml:"commits"`
+	Stopwords   []string `toml:"stopwords"`
+}
+
+// LoadGitleaksRules reads a Gitleaks configuration file. Its rules replace
+// the built-in rules, unless [extend] sets useDefault, in which case they
+// extend this scanner's built-in rules rather than Gitleaks' own defaults,
+// which are not bundled. As in Gitleaks, every match of its rules is reported
+// whatever its confidence score, so their minimum confidence is 0. Fields
+// this scanner does not support are logged and ignored.
+func LoadGitleaksRules(path string) (RuleSet, error) {
+	return loadGitleaksRules(path, 0)
+}
+
+// loadGitleaksRules reads a Gitleaks configuration file and the files it
+// extends
+func loadGitleaksRules(path string, depth int) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	var config gitleaksConfig
+	meta, err := toml.Decode(string(data), &config)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("reading Gitleaks config %s: %w", path, err)
+	}
+	for _, key := range meta.Undecoded() {
+		log.Printf("Warning: %s: unsupported Gitleaks field %s ignored", path, key)
+	}
+
+	// Start from the configuration being extended
+	var set RuleSet
+	if config.Extend.UseDefault {
+		log.Printf("Warning: %s: [extend] useDefault extends this scanner's built-in rules, not the Gitleaks default rules", path)
+		set = DefaultRuleSet()
+	}
+	if config.Extend.Path != "" {
+		if depth >= maxGitleaksExtendDepth {
+			log.Printf("Warning: %s: not extending %s, [extend] is nested more than %d deep", path, config.Extend.Path, maxGitleaksExtendDepth)
+		} else {
+			basePath := config.Extend.Path
+			if !filepath.IsAbs(basePath) {
+				basePath = filepath.Join(filepath.Dir(path), basePath)
+			}
+			base, err := loadGitleaksRules(basePath, depth+1)
+			if err != nil {
+				return RuleSet{}, err
+			}
+			set.Rules = mergeRules(set.Rules, base.Rules)
+			set.Allowlists = append(set.Allowlists, base.Allowlists...)
+		}
+	}
+	if len(config.Extend.DisabledRules) > 0 {
+		set.Rules = disableRules(set.Rules, config.Extend.DisabledRules)
+	}
+
+	var rules []Rule
+	for _, r := range config.Rules {
+		if r.Regex == "" {
+			log.Printf("Warning: %s: rule %s has no regex; rules that match only file paths are not supported", path, r.ID)
+			continue
+		}
+
+		noMinimum := 0.0
+		converted := Rule{
+			ID:          r.ID,
+			Description: r.Description,
+			Regex:       r.Regex,
+			SecretGroup: r.SecretGroup,
+			Keywords:    r.Keywords,
+			Entropy:     r.Entropy,
+			Tags:        r.Tags,
+			Confidence:  &noMinimum,
+		}
+		if r.Path != "" {
+			converted.Paths = []string{r.Path}
+		}
+		if r.Allowlist != nil {
+			converted.Allowlists = append(converted.Allowlists, r.Allowlist.config())
+		}
+		for _, a := range r.Allowlists {
+			converted.Allowlists = append(converted.Allowlists, a.config())
+		}
+		rules = append(rules, converted)
+	}
+	set.Rules = mergeRules(set.Rules, rules)
+
+	if config.Allowlist != nil {
+		set.Allowlists = append(set.Allowlists, config.Allowlist.config())
+	}
+	for _, a := range config.Allowlists {
+		set.Allowlists = append(set.Allowlists, a.config())
+	}
+
+	return set, nil
+}
+
+// config converts a Gitleaks allowlist
+func (a gitleaksAllowlist) config() AllowlistConfig {
+	return AllowlistConfig{
+		Description: a.Description,
+		Condition:   a.Condition,
+		RegexTarget: a.RegexTarget,
+		Regexes:     a.Regexes,
+		Paths:       a.Paths,
+		Commits:     a.Commits,
+		Stopwords:   a.Stopwords,
+	}
+}
+
+// disableRules removes the rules with the given IDs
+func disableRules(rules []Rule, ids []string) []Rule {
+	disabled := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		disabled[id] = true
+	}
+	var kept []Rule
+	for _, r := range rules {
+		if !disabled[r.ID] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
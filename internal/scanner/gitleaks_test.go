@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureLog returns what fn logs
+func captureLog(fn func()) string {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	fn()
+	return buf.String()
+}
+
+// writeGitleaksFiles writes configuration files to a new temporary directory
+// and returns the directory
+func writeGitleaksFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const gitleaksTestRule = `
+[[rules]]
+id = "acme-token"
+description = "Acme token"
+regex = '''acme_([a-z0-9]{32})'''
+secretGroup = 1
+keywords = ["acme_"]
+path = '''\.env$'''
+
+[rules.allowlist]
+stopwords = ["sample"]
+`
+
+func TestLoadGitleaksRules(t *testing.T) {
+	defaultIDs := ruleIDs(DefaultRuleSet().Rules)
+
+	tests := []struct {
+		name    string
+		config  string
+		ids     []string
+		warning string
+	}{
+		{"replaces the built-in rules", gitleaksTestRule, []string{"acme-token"}, ""},
+		{"useDefault extends the built-in rules", "[extend]\nuseDefault = true\n" + gitleaksTestRule,
+			append(append([]string(nil), defaultIDs...), "acme-token"), "not the Gitleaks default rules"},
+		{"disabledRules", "[extend]\nuseDefault = true\ndisabledRules = [\"aws-access-key\", \"private-key\"]\n" + gitleaksTestRule,
+			append(without(defaultIDs, "aws-access-key", "private-key"), "acme-token"), ""},
+		{"path-only rule", gitleaksTestRule + "\n[[rules]]\nid = \"pem-file\"\npath = '''\\.pem$'''\n", []string{"acme-token"}, "rules that match only file paths"},
+		{"unsupported field", gitleaksTestRule + "\n[[rules]]\nid = \"other\"\nregex = \"other_[0-9]{8}\"\nsecretGroupp = 1\n",
+			[]string{"acme-token", "other"}, "unsupported Gitleaks field"},
+	}
+	for _, tt := range tests {
+		dir := writeGitleaksFiles(t, map[string]string{"gitleaks.toml": tt.config})
+		var set RuleSet
+		var err error
+		logged := captureLog(func() { set, err = LoadGitleaksRules(filepath.Join(dir, "gitleaks.toml")) })
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := ruleIDs(set.Rules); !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("%s: got rules %v, want %v", tt.name, got, tt.ids)
+		}
+		if tt.warning != "" && !strings.Contains(logged, tt.warning) {
+			t.Errorf("%s: logged %q, want a warning mentioning %q", tt.name, logged, tt.warning)
+		}
+		if _, err := NewSecretDetectorWithRules(set); err != nil {
+			t.Errorf("%s: compiling the rules: %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoadGitleaksRulesConversion(t *testing.T) {
+	dir := writeGitleaksFiles(t, map[string]string{"gitleaks.toml": gitleaksTestRule + `
+[allowlist]
+description = "vendored code"
+paths = ['''^vendor/''']
+`})
+	set, err := LoadGitleaksRules(filepath.Join(dir, "gitleaks.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zero := 0.0
+	want := Rule{
+		ID:          "acme-token",
+		Description: "Acme token",
+		Regex:       `acme_([a-z0-9]{32})`,
+		SecretGroup: 1,
+		Keywords:    []string{"acme_"},
+		Paths:       []string{`\.env$`},
+		Confidence:  &zero,
+		Allowlists:  []AllowlistConfig{{Stopwords: []string{"sample"}}},
+	}
+	if len(set.Rules) != 1 || !reflect.DeepEqual(set.Rules[0], want) {
+		t.Errorf("got rules %+v, want %+v", set.Rules, want)
+	}
+	if len(set.Allowlists) != 1 || set.Allowlists[0].Description != "vendored code" {
+		t.Errorf("got allowlists %+v, want the vendored code allowlist", set.Allowlists)
+	}
+}
+
+func TestLoadGitleaksRulesExtendDepth(t *testing.T) {
+	rule := func(id string) string {
+		return "\n[[rules]]\nid = \"" + id + "\"\nregex = '''" + id + "_[0-9]{8}'''\n"
+	}
+	dir := writeGitleaksFiles(t, map[string]string{
+		"gitleaks.toml": "[extend]\npath = \"one.toml\"\n" + rule("top"),
+		"one.toml":      "[extend]\npath = \"two.toml\"\n" + rule("one"),
+		"two.toml":      "[extend]\npath = \"three.toml\"\n" + rule("two"),
+		"three.toml":    rule("three"),
+	})
+
+	var set RuleSet
+	var err error
+	logged := captureLog(func() { set, err = LoadGitleaksRules(filepath.Join(dir, "gitleaks.toml")) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ruleIDs(set.Rules), []string{"two", "one", "top"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got rules %v, want %v", got, want)
+	}
+	if !strings.Contains(logged, "nested more than 2 deep") {
+		t.Errorf("logged %q, want a warning about the nesting depth", logged)
+	}
+
+	missing := writeGitleaksFiles(t, map[string]string{"gitleaks.toml": "[extend]\npath = \"missing.toml\"\n"})
+	if _, err := LoadGitleaksRules(filepath.Join(missing, "gitleaks.toml")); err == nil {
+		t.Error("extending a missing file succeeded")
+	}
+}
+
+// without returns ids without the given ones
+func without(ids []string, removed ...string) []string {
+	drop := make(map[string]bool)
+	for _, id := range removed {
+		drop[id] = true
+	}
+	var kept []string
+	for _, id := range ids {
+		if !drop[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+)
+
+// ScanHistory scans the diff of every commit reachable from ref, looking only
+// at added lines, so that secrets which were committed and later removed are
+// still reported. Each secret is attributed to the commit that introduced it.
+func (s *BitbucketScanner) ScanHistory(ctx context.Context, projectKey, repoSlug, ref string) ([]Secret, error) {
+	return s.ScanRange(ctx, projectKey, repoSlug, "", ref)
+}
+
+// ScanRange scans the diffs of the commits reachable from until but not from
+// since, as in git's "since..until", in the same way as ScanHistory. A merge
+// commit is diffed against its first parent, so that lines added while
+// resolving it are scanned too; secrets it merges from another commit in the
+// range are reported only for that commit.
+func (s *BitbucketScanner) ScanRange(ctx context.Context, projectKey, repoSlug, since, until string) ([]Secret, error) {
+	if s.client == nil {
+		return nil, ErrDataCenterOnly
+	}
+
+	commits, err := s.client.GetCommitRange(ctx, projectKey, repoSlug, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits: %w", err)
+	}
+
+	var allSecrets []Secret
+	var merges []bitbucket.Commit
+	for _, commit := range commits {
+		if err := ctx.Err(); err != nil {
+			return allSecrets, err
+		}
+		if len(commit.Parents) > 1 {
+			merges = append(merges, commit)
+			continue
+		}
+		allSecrets = append(allSecrets, s.scanCommitDiff(ctx, projectKey, repoSlug, "", commit)...)
+	}
+
+	found := make(map[string]bool)
+	for _, secret := range allSecrets {
+		found[mergedSecretKey(secret)] = true
+	}
+	for _, commit := range merges {
+		if err := ctx.Err(); err != nil {
+			return allSecrets, err
+		}
+		for _, secret := range s.scanCommitDiff(ctx, projectKey, repoSlug, commit.Parents[0].ID, commit) {
+			if !found[mergedSecretKey(secret)] {
+				allSecrets = append(allSecrets, secret)
+			}
+		}
+	}
+
+	return allSecrets, nil
+}
+
+// scanCommitDiff scans the lines a commit added relative to since, or to its
+// first parent if since is empty
+func (s *BitbucketScanner) scanCommitDiff(ctx context.Context, projectKey, repoSlug, since string, commit bitbucket.Commit) []Secret {
+	diffs, err := s.client.GetCommitDiff(ctx, projectKey, repoSlug, since, commit.ID)
+	if err != nil {
+		log.Printf("Warning: Error getting diff for commit %s: %v", commit.ID, err)
+		return nil
+	}
+
+	var allSecrets []Secret
+	for _, diff := range diffs {
+		path := diffPath(diff)
+		if path == "" {
+			continue
+		}
+
+		fileInfo := bitbucketFileInfo(projectKey, repoSlug, commit.ID, path, commit)
+		secrets, err := s.scanDiff(diff, fileInfo)
+		if err != nil {
+			log.Printf("Warning: Error scanning %s at commit %s: %v", path, commit.ID, err)
+			continue
+		}
+		linkSecrets(secrets, s.client.WebLinks())
+		allSecrets = append(allSecrets, secrets...)
+	}
+	return allSecrets
+}
+
+// mergedSecretKey identifies a secret in a file independently of the commit
+// and line, to recognize a secret a merge brings in from a merged commit
+func mergedSecretKey(secret Secret) string {
+	return strings.Join([]string{secret.Filename, secret.RuleID, secret.SecretValue}, "\x00")
+}
+
+// ScanNewRef scans the commits a newly created branch or tag adds: those
+// reachable from commitID but not from the default branch. When ref is the
+// default branch, or the repository has no other branch yet, its whole
+// history is scanned.
+func (s *BitbucketScanner) ScanNewRef(ctx context.Context, projectKey, repoSlug, ref, commitID string) ([]Secret, error) {
+	if s.client == nil {
+		return nil, ErrDataCenterOnly
+	}
+
+	since := ""
+	branch, err := s.client.GetDefaultBranch(ctx, projectKey, repoSlug)
+	switch {
+	case err == nil && branch.ID != ref:
+		since = branch.ID
+	case err != nil && !bitbucket.IsNotFound(err):
+		return nil, fmt.Errorf("getting default branch: %w", err)
+	}
+
+	return s.ScanRange(ctx, projectKey, repoSlug, since, commitID)
+}
@@ -0,0 +1,252 @@
+package scanner
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// keywordMatcher finds which of a set of keywords occur in a text in a single
+// pass, using the Aho-Corasick algorithm. Matching ignores ASCII case;
+// keywords must be lower case.
+type keywordMatcher struct {
+	next    [][256]int32 // Transitions of each state, with failure links resolved
+	outputs [][]int      // Indices of the keywords that end at each state
+}
+
+// newKeywordMatcher builds a matcher for keywords
+func newKeywordMatcher(keywords []string) *keywordMatcher {
+	m := &keywordMatcher{}
+	m.addState()
+
+	// Build the trie of the keywords
+	for i, keyword := range keywords {
+		state := int32(0)
+		for j := 0; j < len(keyword); j++ {
+			c := keyword[j]
+			if m.next[state][c] == 0 {
+				m.next[state][c] = m.addState()
+			}
+			state = m.next[state][c]
+		}
+		m.outputs[state] = append(m.outputs[state], i)
+	}
+
+	// Resolve failure links breadth first, so that every state has a
+	// transition for every byte and inherits the outputs of its longest
+	// proper suffix that is also in the trie
+	fail := make([]int32, len(m.next))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if child := m.next[0][c]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		m.outputs[state] = append(m.outputs[state], m.outputs[fail[state]]...)
+		for c := 0; c < 256; c++ {
+			child := m.next[state][c]
+			if child == 0 {
+				m.next[state][c] = m.next[fail[state]][c]
+				continue
+			}
+			fail[child] = m.next[fail[state]][c]
+			queue = append(queue, child)
+		}
+	}
+
+	// Fold upper case ASCII onto the lower case transitions
+	for state := range m.next {
+		for c := 'A'; c <= 'Z'; c++ {
+			m.next[state][c] = m.next[state][c+'a'-'A']
+		}
+	}
+
+	return m
+}
+
+// addState adds an empty state and returns its index
+func (m *keywordMatcher) addState() int32 {
+	m.next = append(m.next, [256]int32{})
+	m.outputs = append(m.outputs, nil)
+	return int32(len(m.next) - 1)
+}
+
+// match calls found with the index of each keyword occurrence in text
+func (m *keywordMatcher) match(text string, found func(keyword int)) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		state = m.next[state][text[i]]
+		for _, keyword := range m.outputs[state] {
+			found(keyword)
+		}
+	}
+}
+
+// prefilterLiterals returns lower case strings of which every match of the
+// rule contains at least one: its keywords, or else the literal prefixes of
+// its regex. It returns nil when there are none, and the rule must be
+// evaluated on every line.
+func prefilterLiterals(r *compiledRule) []string {
+	if len(r.keywords) > 0 {
+		return r.keywords
+	}
+	re, err := syntax.Parse(r.Regex, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	prefixes, ok := literalPrefixes(re)
+	if !ok {
+		return nil
+	}
+	return prefixes
+}
+
+// maxPrefixes limits how many alternative prefixes are derived from a regex
+const maxPrefixes = 64
+
+// maxClassSize is the largest character class expanded into prefixes
+const maxClassSize = 4
+
+// literalPrefixes returns lower case literals one of which every match of re
+// starts with, if there are such literals
+func literalPrefixes(re *syntax.Regexp) ([]string, bool) {
+	all, _ := prefixSet(re)
+	if len(all) == 0 || len(all) > maxPrefixes {
+		return nil, false
+	}
+	var prefixes []string
+	for _, prefix := range all {
+		if prefix == "" {
+			return nil, false
+		}
+		prefixes = appendMissing(prefixes, prefix)
+	}
+	return prefixes, true
+}
+
+// prefixSet returns lower case strings one of which every match of re starts
+// with, or nil if it does not know of any. exact is set when the strings are
+// all the text re can match, so that what follows re extends them.
+func prefixSet(re *syntax.Regexp) (prefixes []string, exact bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpBeginText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		// Assertions match no text
+		return []string{""}, true
+	case syntax.OpLiteral:
+		return []string{strings.ToLower(string(re.Rune))}, true
+	case syntax.OpCharClass:
+		var chars []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for c := re.Rune[i]; c <= re.Rune[i+1]; c++ {
+				chars = appendMissing(chars, strings.ToLower(string(c)))
+				if len(chars) > maxClassSize {
+					return nil, false
+				}
+			}
+		}
+		return chars, true
+	case syntax.OpCapture:
+		return prefixSet(re.Sub[0])
+	case syntax.OpPlus:
+		prefixes, _ := prefixSet(re.Sub[0])
+		return prefixes, false
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil, false
+		}
+		prefixes, _ := prefixSet(re.Sub[0])
+		return prefixes, false
+	case syntax.OpQuest:
+		prefixes, exact := prefixSet(re.Sub[0])
+		if prefixes == nil {
+			return nil, false
+		}
+		return append([]string{""}, prefixes...), exact
+	case syntax.OpAlternate:
+		exact := true
+		for _, sub := range re.Sub {
+			subPrefixes, subExact := prefixSet(sub)
+			if subPrefixes == nil {
+				return nil, false
+			}
+			prefixes = append(prefixes, subPrefixes...)
+			exact = exact && subExact
+		}
+		return prefixes, exact
+	case syntax.OpConcat:
+		// Extend the prefixes with each part for as long as they are exact
+		prefixes = []string{""}
+		for _, sub := range re.Sub {
+			subPrefixes, subExact := prefixSet(sub)
+			if subPrefixes == nil || len(prefixes)*len(subPrefixes) > maxPrefixes {
+				return prefixes, false
+			}
+			var extended []string
+			for _, prefix := range prefixes {
+				for _, subPrefix := range subPrefixes {
+					extended = append(extended, prefix+subPrefix)
+				}
+			}
+			prefixes = extended
+			if !subExact {
+				return prefixes, false
+			}
+		}
+		return prefixes, true
+	default:
+		return nil, false
+	}
+}
+
+// minMatchLength returns a lower bound on the length in bytes of any match of
+// a regex
+func minMatchLength(expr string) int {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return 0
+	}
+	return minLength(re)
+}
+
+// minLength returns the minimum number of characters matched by re
+func minLength(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return minLength(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * minLength(re.Sub[0])
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			total += minLength(sub)
+		}
+		return total
+	case syntax.OpAlternate:
+		shortest := -1
+		for _, sub := range re.Sub {
+			if length := minLength(sub); shortest < 0 || length < shortest {
+				shortest = length
+			}
+		}
+		return shortest
+	default:
+		return 0
+	}
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
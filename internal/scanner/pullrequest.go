@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+)
+
+// ScanPullRequest scans the lines added by a pull request. Secrets are
+// attributed to the latest commit on the pull request's source branch.
+func (s *BitbucketScanner) ScanPullRequest(ctx context.Context, projectKey, repoSlug string, pullRequestID int) ([]Secret, error) {
+	if s.client == nil {
+		return nil, ErrDataCenterOnly
+	}
+
+	pullRequest, err := s.client.GetPullRequest(ctx, projectKey, repoSlug, pullRequestID)
+	if err != nil {
+		return nil, fmt.Errorf("getting pull request: %w", err)
+	}
+
+	commit, err := s.client.GetCommit(ctx, projectKey, repoSlug, pullRequest.FromRef.LatestCommit)
+	if err != nil {
+		return nil, fmt.Errorf("getting commit info: %w", err)
+	}
+
+	diffs, err := s.client.GetPullRequestDiff(ctx, projectKey, repoSlug, pullRequestID)
+	if err != nil {
+		return nil, fmt.Errorf("getting pull request diff: %w", err)
+	}
+
+	var allSecrets []Secret
+	for _, diff := range diffs {
+		if err := ctx.Err(); err != nil {
+			return allSecrets, err
+		}
+
+		path := diffPath(diff)
+		if path == "" {
+			continue
+		}
+
+		fileInfo := bitbucketFileInfo(projectKey, repoSlug, commit.ID, path, commit)
+		secrets, err := s.scanDiff(diff, fileInfo)
+		if err != nil {
+			log.Printf("Warning: Error scanning %s in pull request %d: %v", path, pullRequestID, err)
+			continue
+		}
+		linkSecrets(secrets, s.client.WebLinks())
+		allSecrets = append(allSecrets, secrets...)
+	}
+
+	return allSecrets, nil
+}
+
+// maxPullRequestComments is the most comments posted on a pull request by
+// one scan, so that a change full of secrets does not bury the review
+const maxPullRequestComments = 20
+
+// pullRequestCommentHeading starts every comment the scanner posts, which is
+// how comments from earlier scans are recognised
+const pullRequestCommentHeading = "**Possible secret detected: "
+
+// commentAnchor is a line of a file in a pull request
+type commentAnchor struct {
+	path string
+	line int
+}
+
+// CommentOnPullRequest posts one comment per line with a secret, anchored to
+// the added line it was found on. Lines that already have a comment from an
+// earlier scan are skipped, and at most maxPullRequestComments comments are
+// posted. It returns the number of comments posted.
+func (s *BitbucketScanner) CommentOnPullRequest(ctx context.Context, projectKey, repoSlug string, pullRequestID int, secrets []Secret) (int, error) {
+	if s.client == nil {
+		return 0, ErrDataCenterOnly
+	}
+
+	commented := make(map[commentAnchor]bool)
+	fetched := make(map[string]bool)
+	posted := 0
+	for i, secret := range secrets {
+		if err := ctx.Err(); err != nil {
+			return posted, err
+		}
+
+		if !fetched[secret.Filename] {
+			fetched[secret.Filename] = true
+			existing, err := s.client.GetPullRequestComments(ctx, projectKey, repoSlug, pullRequestID, secret.Filename)
+			if err != nil {
+				return posted, fmt.Errorf("getting comments on %s: %w", secret.Filename, err)
+			}
+			for _, comment := range existing {
+				if comment.Anchor != nil && strings.HasPrefix(comment.Text, pullRequestCommentHeading) {
+					commented[commentAnchor{comment.Anchor.Path, comment.Anchor.Line}] = true
+				}
+			}
+		}
+
+		anchor := commentAnchor{secret.Filename, secret.LineNumber}
+		if commented[anchor] {
+			continue
+		}
+		if posted == maxPullRequestComments {
+			log.Printf("Warning: Posted the maximum of %d comments on pull request %d; %d more lines with secrets were not commented on",
+				maxPullRequestComments, pullRequestID, uncommented(secrets[i:], commented))
+			break
+		}
+
+		comment := bitbucket.Comment{
+			Text: pullRequestCommentText(secret),
+			Anchor: &bitbucket.CommentAnchor{
+				Path:     secret.Filename,
+				Line:     secret.LineNumber,
+				LineType: "ADDED",
+				FileType: "TO",
+				DiffType: "EFFECTIVE",
+			},
+		}
+
+		if _, err := s.client.AddPullRequestComment(ctx, projectKey, repoSlug, pullRequestID, comment); err != nil {
+			return posted, fmt.Errorf("commenting on %s:%d: %w", secret.Filename, secret.LineNumber, err)
+		}
+		commented[anchor] = true
+		posted++
+	}
+
+	return posted, nil
+}
+
+// uncommented counts the lines with secrets that have no comment
+func uncommented(secrets []Secret, commented map[commentAnchor]bool) int {
+	lines := make(map[commentAnchor]bool)
+	for _, secret := range secrets {
+		anchor := commentAnchor{secret.Filename, secret.LineNumber}
+		if !commented[anchor] {
+			lines[anchor] = true
+		}
+	}
+	return len(lines)
+}
+
+// pullRequestCommentText formats the comment for a secret without repeating
+// its value, linking to the line when the secret has a web link
+func pullRequestCommentText(secret Secret) string {
+	text := fmt.Sprintf("%s%s** (confidence %.0f)\n\n`%s`\n\n",
+		pullRequestCommentHeading, secret.SecretType, secret.Confidence, RedactSecretValue(secret.SecretValue))
+	if secret.WebURL != "" {
+		text += fmt.Sprintf("Found at [%s:%d](%s)\n\n", secret.Filename, secret.LineNumber, secret.WebURL)
+	}
+	return text + "If this is a real credential, revoke it and remove it from the change before merging."
+}
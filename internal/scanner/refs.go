@@ -0,0 +1,180 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+)
+
+// refHead is a branch or tag and the commit it points at
+type refHead struct {
+	name     string
+	commitID string
+}
+
+// ScanAllRefs scans the head of every branch and tag in a repository. Each
+// distinct file content is scanned only once; a secret found in a file is
+// reported once per path, listing every ref whose tree contains it.
+func (s *BitbucketScanner) ScanAllRefs(ctx context.Context, projectKey, repoSlug string) ([]Secret, error) {
+	if s.client == nil {
+		return nil, ErrDataCenterOnly
+	}
+
+	heads, err := s.listRefHeads(ctx, projectKey, repoSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refs that point at the same commit share a single scan
+	var commitOrder []string
+	refsByCommit := make(map[string][]string)
+	for _, head := range heads {
+		if _, seen := refsByCommit[head.commitID]; !seen {
+			commitOrder = append(commitOrder, head.commitID)
+		}
+		refsByCommit[head.commitID] = append(refsByCommit[head.commitID], head.name)
+	}
+
+	// Detector results by content hash, and the reported secrets by path and content hash
+	resultsByHash := make(map[string][]Secret)
+	findingsByFile := make(map[string][]int)
+	var findings []Secret
+	links := s.host.WebLinks()
+
+	for _, commitID := range commitOrder {
+		if err := ctx.Err(); err != nil {
+			return findings, err
+		}
+		refs := refsByCommit[commitID]
+
+		commit, err := s.host.GetCommit(ctx, projectKey, repoSlug, commitID)
+		if err != nil {
+			log.Printf("Warning: Error getting commit %s for %v: %v", commitID, refs, err)
+			continue
+		}
+
+		fileList, err := s.host.GetFileList(ctx, projectKey, repoSlug, commitID)
+		if err != nil {
+			log.Printf("Warning: Error getting file list for %v: %v", refs, err)
+			continue
+		}
+
+		for _, file := range fileList {
+			if err := ctx.Err(); err != nil {
+				return findings, err
+			}
+			if file.Type != "FILE" {
+				continue
+			}
+
+			fileInfo := bitbucketFileInfo(projectKey, repoSlug, commitID, file.Path, commit)
+			content, reason, err := s.fetchContent(ctx, fileInfo)
+			if err != nil {
+				if isAccessDenied(err) {
+					return findings, fmt.Errorf("reading file %s: %w", file.Path, err)
+				}
+				if bitbucket.IsNotFound(err) {
+					log.Printf("Warning: Skipping file %s, not found at commit %s", file.Path, commitID)
+					continue
+				}
+				log.Printf("Warning: Error fetching file %s at %s: %v", file.Path, commitID, err)
+				continue
+			}
+			if reason != "" {
+				s.skip(fileInfo, reason)
+				continue
+			}
+
+			sum := sha256.Sum256([]byte(content))
+			hash := hex.EncodeToString(sum[:])
+			fileKey := file.Path + "\x00" + hash
+
+			// The same content at the same path was already reported; only add the refs
+			if indexes, seen := findingsByFile[fileKey]; seen {
+				for _, i := range indexes {
+					findings[i].Refs = appendMissing(findings[i].Refs, refs...)
+				}
+				continue
+			}
+
+			resultKey := s.detector.resultKey(hash, fileInfo)
+			results, scanned := resultsByHash[resultKey]
+			if !scanned {
+				results, err = s.cache.scan(s.detector, content, fileInfo)
+				if err != nil {
+					log.Printf("Warning: Error scanning file %s at %s: %v", file.Path, commitID, err)
+					continue
+				}
+				resultsByHash[resultKey] = results
+			}
+
+			var fileSecrets []Secret
+			for _, result := range results {
+				secret := result
+				secret.ProjectKey = fileInfo.ProjectKey
+				secret.RepositorySlug = fileInfo.RepositorySlug
+				secret.CommitID = fileInfo.CommitID
+				secret.CommitDate = fileInfo.CommitDate
+				secret.CommitAuthor = fileInfo.CommitAuthor
+				secret.Filename = fileInfo.Filename
+				secret.Refs = append([]string(nil), refs...)
+				secret.WebURL = links.FileURL(secret.ProjectKey, secret.RepositorySlug, secret.CommitID, secret.Filename, secret.LineNumber)
+				fileSecrets = append(fileSecrets, secret)
+			}
+
+			// Suppressed findings are counted for each path of the content
+			var indexes []int
+			for _, secret := range s.keep(fileSecrets) {
+				indexes = append(indexes, len(findings))
+				findings = append(findings, secret)
+			}
+			findingsByFile[fileKey] = indexes
+		}
+	}
+
+	return findings, nil
+}
+
+// listRefHeads lists the branches and tags of a repository with their head commits
+func (s *BitbucketScanner) listRefHeads(ctx context.Context, projectKey, repoSlug string) ([]refHead, error) {
+	branches, err := s.client.GetBranches(ctx, projectKey, repoSlug)
+	if err != nil {
+		return nil, fmt.Errorf("listing branches: %w", err)
+	}
+
+	tags, err := s.client.GetTags(ctx, projectKey, repoSlug)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+
+	var heads []refHead
+	for _, branch := range branches {
+		heads = append(heads, refHead{name: branch.ID, commitID: branch.LatestCommit})
+	}
+	for _, tag := range tags {
+		heads = append(heads, refHead{name: tag.ID, commitID: tag.LatestCommit})
+	}
+
+	return heads, nil
+}
+
+// appendMissing appends the values that are not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,259 @@
+package scanner
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRulesTOML is the built-in rule set
+//
+//go:embed default_rules.toml
+var defaultRulesTOML []byte
+
+// DefaultConfidence is the minimum confidence of a finding when a rule does not set one
+const DefaultConfidence = 50
+
+// minSecretLength is the length below which matched values are ignored
+const minSecretLength = 6
+
+// Rule is a detection rule as written in a rules file. See
+// default_rules.toml for the meaning of each field. The ID identifies the
+// rule in findings and must not change between releases.
+type Rule struct {
+	ID           string   `json:"id" toml:"id" yaml:"id"`
+	Description  string   `json:"description,omitempty" toml:"description" yaml:"description"`
+	Regex        string   `json:"regex" toml:"regex" yaml:"regex"`
+	SecretGroup  int      `json:"secret_group,omitempty" toml:"secret_group" yaml:"secret_group"`
+	Keywords     []string `json:"keywords,omitempty" toml:"keywords" yaml:"keywords"`
+	Entropy      float64  `json:"entropy,omitempty" toml:"entropy" yaml:"entropy"`
+	Confidence   *float64 `json:"confidence,omitempty" toml:"confidence" yaml:"confidence"`
+	Severity     string   `json:"severity,omitempty" toml:"severity" yaml:"severity"`
+	Tags         []string `json:"tags,omitempty" toml:"tags" yaml:"tags"`
+	Paths        []string `json:"paths,omitempty" toml:"paths" yaml:"paths"`
+	End          string   `json:"end,omitempty" toml:"end" yaml:"end"`
+	Exclusive    bool     `json:"exclusive,omitempty" toml:"exclusive" yaml:"exclusive"`
+	Decode       string   `json:"decode,omitempty" toml:"decode" yaml:"decode"`
+	IgnoreDotted bool     `json:"ignore_dotted,omitempty" toml:"ignore_dotted" yaml:"ignore_dotted"`
+
+	Allowlists []AllowlistConfig `json:"allowlists,omitempty" toml:"allowlists" yaml:"allowlists"`
+}
+
+// RuleSet is the rules a detector evaluates, in order, and the allowlists
+// that apply to every rule
+type RuleSet struct {
+	Rules      []Rule            `json:"rules"`
+	Allowlists []AllowlistConfig `json:"allowlists,omitempty"`
+}
+
+// rulesFile is the layout of a rules file
+type rulesFile struct {
+	ReplaceDefaults bool              `json:"replace_defaults" toml:"replace_defaults" yaml:"replace_defaults"`
+	Rules           []Rule            `json:"rules" toml:"rules" yaml:"rules"`
+	Allowlists      []AllowlistConfig `json:"allowlists" toml:"allowlists" yaml:"allowlists"`
+}
+
+// compiledRule is a compiled detection rule
+type compiledRule struct {
+	Rule
+	regex         *regexp.Regexp
+	end           *regexp.Regexp // Ends a multi-line secret, or nil
+	paths         []*regexp.Regexp
+	keywords      []string // Lower case
+	allowlists    []*allowlist
+	minConfidence float64
+	minLength     int // Lines shorter than this cannot match
+
+}
+
+// DefaultRuleSet returns the built-in rules and allowlists
+func DefaultRuleSet() RuleSet {
+	var file rulesFile
+	if err := decodeRules(defaultRulesTOML, ".toml", &file); err != nil {
+		panic(fmt.Sprintf("invalid built-in rules: %v", err))
+	}
+	return RuleSet{Rules: file.Rules, Allowlists: file.Allowlists}
+}
+
+// LoadRules reads a TOML, YAML or JSON rules file, chosen by its extension.
+// The rules and allowlists extend the built-in ones, rules replacing any
+// built-in rule with the same ID, unless the file sets replace_defaults.
+func LoadRules(path string) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	var file rulesFile
+	if err := decodeRules(data, strings.ToLower(filepath.Ext(path)), &file); err != nil {
+		return RuleSet{}, fmt.Errorf("reading rules file %s: %w", path, err)
+	}
+
+	set := RuleSet{Rules: file.Rules, Allowlists: file.Allowlists}
+	if !file.ReplaceDefaults {
+		defaults := DefaultRuleSet()
+		set.Rules = mergeRules(defaults.Rules, file.Rules)
+		set.Allowlists = append(defaults.Allowlists, file.Allowlists...)
+	}
+	return set, nil
+}
+
+// decodeRules decodes a rules file, rejecting unknown fields so that typos
+// are not silently ignored
+func decodeRules(data []byte, ext string, file *rulesFile) error {
+	switch ext {
+	case ".toml":
+		meta, err := toml.Decode(string(data), file)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown field %s", undecoded[0])
+		}
+		return nil
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		return decoder.Decode(file)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(file)
+	default:
+		return fmt.Errorf("unsupported rules file extension %q, expected .toml, .yaml, .yml or .json", ext)
+	}
+}
+
+// mergeRules appends custom rules to base. A custom rule with the ID of a
+// base rule takes its place.
+func mergeRules(base, custom []Rule) []Rule {
+	merged := append([]Rule(nil), base...)
+	index := make(map[string]int, len(merged))
+	for i, r := range merged {
+		index[r.ID] = i
+	}
+	for _, r := range custom {
+		if i, ok := index[r.ID]; ok {
+			merged[i] = r
+			continue
+		}
+		index[r.ID] = len(merged)
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// compileRules validates and compiles rules
+func compileRules(configs []Rule) ([]*compiledRule, error) {
+	rules := make([]*compiledRule, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+
+	for _, config := range configs {
+		if config.ID == "" {
+			return nil, fmt.Errorf("rule with regex %q has no id", config.Regex)
+		}
+		if seen[config.ID] {
+			return nil, fmt.Errorf("rule %s: duplicate id", config.ID)
+		}
+		seen[config.ID] = true
+
+		if config.Regex == "" {
+			return nil, fmt.Errorf("rule %s: regex is required", config.ID)
+		}
+		regex, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", config.ID, err)
+		}
+		if config.SecretGroup < 0 || config.SecretGroup > regex.NumSubexp() {
+			return nil, fmt.Errorf("rule %s: secret_group %d but the regex has %d groups", config.ID, config.SecretGroup, regex.NumSubexp())
+		}
+		if config.Decode != "" && config.Decode != "base64" {
+			return nil, fmt.Errorf("rule %s: unsupported decode %q", config.ID, config.Decode)
+		}
+		var end *regexp.Regexp
+		if config.End != "" {
+			if config.Decode != "" {
+				return nil, fmt.Errorf("rule %s: end cannot be used with decode", config.ID)
+			}
+			if end, err = regexp.Compile(config.End); err != nil {
+				return nil, fmt.Errorf("rule %s: end: %w", config.ID, err)
+			}
+		}
+
+		config.Severity = strings.ToUpper(config.Severity)
+		switch config.Severity {
+		case "", "LOW", "MEDIUM", "HIGH":
+		default:
+			return nil, fmt.Errorf("rule %s: severity must be LOW, MEDIUM or HIGH", config.ID)
+		}
+		if config.Description == "" {
+			config.Description = config.ID
+		}
+
+		compiled := &compiledRule{Rule: config, regex: regex, end: end, minConfidence: DefaultConfidence}
+		if config.Confidence != nil {
+			compiled.minConfidence = *config.Confidence
+		}
+		compiled.allowlists, err = compileAllowlists(config.Allowlists)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", config.ID, err)
+		}
+		for _, path := range config.Paths {
+			pathRegex, err := regexp.Compile(path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: path %q: %w", config.ID, path, err)
+			}
+			compiled.paths = append(compiled.paths, pathRegex)
+		}
+		for _, keyword := range config.Keywords {
+			compiled.keywords = append(compiled.keywords, strings.ToLower(keyword))
+		}
+		compiled.minLength = minMatchLength(config.Regex)
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+// appliesToPath reports whether the rule should run on a file
+func (r *compiledRule) appliesToPath(path string) bool {
+	return len(r.paths) == 0 || anyMatch(r.paths, path)
+}
+
+// ruleMatch is a match of a rule on a line
+type ruleMatch struct {
+	secret string // The secret, from the rule's secret group
+	text   string // The whole match
+	column int    // 1-based byte column of the secret on the line
+}
+
+// matches returns the matches of the rule on a line
+func (r *compiledRule) matches(line string) []ruleMatch {
+	var matches []ruleMatch
+	for _, loc := range r.regex.FindAllStringSubmatchIndex(line, -1) {
+		// The secret is the rule's secret group, or the first group, falling
+		// back to the whole match when that group did not match
+		group := r.SecretGroup
+		if group == 0 && len(loc) > 2 {
+			group = 1
+		}
+		start, end := loc[0], loc[1]
+		if group > 0 && loc[2*group] >= 0 && loc[2*group] < loc[2*group+1] {
+			start, end = loc[2*group], loc[2*group+1]
+		}
+		matches = append(matches, ruleMatch{
+			secret: line[start:end],
+			text:   line[loc[0]:loc[1]],
+			column: start + 1,
+		})
+	}
+	return matches
+}
@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to name in a new temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// ruleIDs returns the ID of each rule
+func ruleIDs(rules []Rule) []string {
+	var ids []string
+	for _, r := range rules {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestLoadRules(t *testing.T) {
+	defaults := DefaultRuleSet()
+	defaultIDs := ruleIDs(defaults.Rules)
+
+	tests := []struct {
+		name       string
+		file       string
+		content    string
+		ids        []string // nil for the defaults followed by acme-token
+		allowlists int
+		wantErr    string
+	}{
+		{"TOML", "rules.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_[a-z0-9]{32}'''
+`, nil, len(defaults.Allowlists), ""},
+		{"YAML", "rules.yaml", `
+rules:
+  - id: acme-token
+    regex: 'acme_[a-z0-9]{32}'
+allowlists:
+  - paths: ['^vendor/']
+`, nil, len(defaults.Allowlists) + 1, ""},
+		{"JSON", "rules.json", `{"rules": [{"id": "acme-token", "regex": "acme_[a-z0-9]{32}"}]}`,
+			nil, len(defaults.Allowlists), ""},
+		{"replace defaults", "rules.toml", `
+replace_defaults = true
+[[rules]]
+id = "acme-token"
+regex = '''acme_[a-z0-9]{32}'''
+`, []string{"acme-token"}, 0, ""},
+		{"replace a built-in rule in place", "rules.yml", `
+rules:
+  - id: aws-access-key
+    regex: 'AKIA[0-9A-Z]{16}'
+    severity: high
+`, defaultIDs, len(defaults.Allowlists), ""},
+		{"unknown TOML field", "rules.toml", "[[rules]]\nid = \"x\"\nregex = \"x\"\nregexp = \"y\"\n", nil, 0, "regexp"},
+		{"unknown YAML field", "rules.yaml", "rules:\n  - id: x\n    regex: x\n    entropie: 3\n", nil, 0, "entropie"},
+		{"unknown JSON field", "rules.json", `{"rules": [{"id": "x", "regex": "x", "keyword": ["x"]}]}`, nil, 0, "keyword"},
+		{"unsupported extension", "rules.ini", "", nil, 0, "unsupported rules file extension"},
+	}
+	for _, tt := range tests {
+		set, err := LoadRules(writeFile(t, tt.file, tt.content))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		want := tt.ids
+		if want == nil {
+			want = append(append([]string(nil), defaultIDs...), "acme-token")
+		}
+		if got := ruleIDs(set.Rules); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got rules %v, want %v", tt.name, got, want)
+		}
+		if len(set.Allowlists) != tt.allowlists {
+			t.Errorf("%s: got %d allowlists, want %d", tt.name, len(set.Allowlists), tt.allowlists)
+		}
+		if _, err := NewSecretDetectorWithRules(set); err != nil {
+			t.Errorf("%s: compiling the rules: %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoadRulesReplacesBuiltInRule(t *testing.T) {
+	set, err := LoadRules(writeFile(t, "rules.toml", "[[rules]]\nid = \"aws-access-key\"\nregex = '''AKIA[0-9A-Z]{16}'''\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range set.Rules {
+		if r.ID == "aws-access-key" && (r.Regex != "AKIA[0-9A-Z]{16}" || len(r.Tags) != 0) {
+			t.Errorf("got rule %+v, want the rule from the file", r)
+		}
+	}
+}
+
+func TestCompileRulesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"no id", Rule{Regex: "x"}, "has no id"},
+		{"no regex", Rule{ID: "x"}, "regex is required"},
+		{"invalid regex", Rule{ID: "x", Regex: "("}, "missing closing )"},
+		{"secret group out of range", Rule{ID: "x", Regex: "(a)", SecretGroup: 2}, "secret_group 2"},
+		{"unknown decode", Rule{ID: "x", Regex: "x", Decode: "hex"}, "unsupported decode"},
+		{"end with decode", Rule{ID: "x", Regex: "x", End: "y", Decode: "base64"}, "end cannot be used with decode"},
+		{"invalid severity", Rule{ID: "x", Regex: "x", Severity: "urgent"}, "severity"},
+	}
+	for _, tt := range tests {
+		_, err := compileRules([]Rule{tt.rule})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := compileRules([]Rule{{ID: "x", Regex: "a"}, {ID: "x", Regex: "b"}}); err == nil || !strings.Contains(err.Error(), "duplicate id") {
+		t.Errorf("duplicate ids: got error %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSortSecrets(t *testing.T) {
+	// In the order SortSecrets puts them
+	want := []Secret{
+		{ProjectKey: "A", RepositorySlug: "z", Filename: "z.txt", LineNumber: 9},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "a.txt", LineNumber: 2},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "a.txt", LineNumber: 10},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 3},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 12, RuleID: "aws-access-key"},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 12, RuleID: "base64-potential", SecretType: "Base64 Decoded Password"},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 12, RuleID: "base64-potential", SecretType: "Password"},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 12, RuleID: "base64-potential", SecretType: "Password", CommitID: "aaa"},
+		{ProjectKey: "B", RepositorySlug: "app", Filename: "b.txt", LineNumber: 1, Column: 12, RuleID: "base64-potential", SecretType: "Password", CommitID: "bbb"},
+		{ProjectKey: "B", RepositorySlug: "web", Filename: "a.txt", LineNumber: 1},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		got := append([]Secret(nil), want...)
+		random.Shuffle(len(got), func(i, j int) { got[i], got[j] = got[j], got[i] })
+		SortSecrets(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got order\n%+v\nwant\n%+v", got, want)
+		}
+	}
+}
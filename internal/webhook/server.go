@@ -0,0 +1,262 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"bitbucket-secrets-scanner/internal/scanner"
+)
+
+// maxPayloadSize is the largest webhook body that is accepted
+const maxPayloadSize = 5 << 20
+
+// zeroHash is the commit ID Bitbucket reports for the missing side of a created or deleted ref
+const zeroHash = "0000000000000000000000000000000000000000"
+
+// Job is a scan queued in response to a webhook
+type Job struct {
+	Event          string
+	ProjectKey     string
+	RepositorySlug string
+	Ref            string
+	FromCommitID   string // Set for pushes that update an existing ref
+	CommitID       string // Set for pushes
+	PullRequestID  int    // Set for pull requests
+}
+
+// ResultHandler receives the outcome of each scan. It is called from one
+// worker at a time.
+type ResultHandler func(job Job, secrets []scanner.Secret, err error)
+
+// Server receives Bitbucket Data Center webhooks, verifies their signature
+// and scans the pushed commits and opened or updated pull requests in the
+// background
+type Server struct {
+	secret     []byte
+	newScanner func() *scanner.BitbucketScanner
+	onResult   ResultHandler
+	queue      chan Job
+	queueMu    sync.Mutex // Held while queueing the jobs of one delivery
+	mu         sync.Mutex
+}
+
+// NewServer creates a webhook server. secret is the webhook secret configured
+// in Bitbucket; newScanner creates the scanner for each job, so that
+// concurrent scans do not share skipped and suppressed file lists;
+// queueSize is the number of scans that may wait before new webhooks are
+// rejected.
+func NewServer(secret string, newScanner func() *scanner.BitbucketScanner, queueSize int, onResult ResultHandler) *Server {
+	return &Server{
+		secret:     []byte(secret),
+		newScanner: newScanner,
+		onResult:   onResult,
+		queue:      make(chan Job, queueSize),
+	}
+}
+
+// Run processes queued scans with the given number of workers until ctx is cancelled
+func (s *Server) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue:
+					s.process(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// process runs one scan and reports its result. Pushes scan only the pushed
+// commits, so secrets already in the repository are not reported again.
+func (s *Server) process(ctx context.Context, job Job) {
+	var (
+		secrets []scanner.Secret
+		err     error
+	)
+
+	bitbucketScanner := s.newScanner()
+	switch {
+	case job.PullRequestID != 0:
+		log.Printf("Scanning pull request %d in %s/%s", job.PullRequestID, job.ProjectKey, job.RepositorySlug)
+		secrets, err = bitbucketScanner.ScanPullRequest(ctx, job.ProjectKey, job.RepositorySlug, job.PullRequestID)
+		if err == nil && len(secrets) > 0 {
+			if _, commentErr := bitbucketScanner.CommentOnPullRequest(ctx, job.ProjectKey, job.RepositorySlug, job.PullRequestID, secrets); commentErr != nil {
+				log.Printf("Warning: Error commenting on pull request %d: %v", job.PullRequestID, commentErr)
+			}
+		}
+	case job.FromCommitID != "":
+		log.Printf("Scanning %s/%s at %s (%s..%s)", job.ProjectKey, job.RepositorySlug, job.Ref, job.FromCommitID, job.CommitID)
+		secrets, err = bitbucketScanner.ScanRange(ctx, job.ProjectKey, job.RepositorySlug, job.FromCommitID, job.CommitID)
+	default:
+		log.Printf("Scanning new ref %s in %s/%s (%s)", job.Ref, job.ProjectKey, job.RepositorySlug, job.CommitID)
+		secrets, err = bitbucketScanner.ScanNewRef(ctx, job.ProjectKey, job.RepositorySlug, job.Ref, job.CommitID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onResult(job, secrets, err)
+}
+
+// repository identifies a repository in a webhook payload
+type repository struct {
+	Slug    string `json:"slug"`
+	Project struct {
+		Key string `json:"key"`
+	} `json:"project"`
+}
+
+// refsChangedPayload is the body of a repo:refs_changed webhook
+type refsChangedPayload struct {
+	Repository repository `json:"repository"`
+	Changes    []struct {
+		Ref struct {
+			ID   string `json:"id"`
+			Type string `json:"type"` // "BRANCH" or "TAG"
+		} `json:"ref"`
+		FromHash string `json:"fromHash"`
+		ToHash   string `json:"toHash"`
+		Type     string `json:"type"` // "ADD", "UPDATE" or "DELETE"
+	} `json:"changes"`
+}
+
+// pullRequestPayload is the body of a pr:* webhook
+type pullRequestPayload struct {
+	PullRequest struct {
+		ID    int `json:"id"`
+		ToRef struct {
+			ID         string     `json:"id"`
+			Repository repository `json:"repository"`
+		} `json:"toRef"`
+	} `json:"pullRequest"`
+}
+
+// ServeHTTP accepts a webhook delivery, queueing a scan for each pushed ref or
+// opened or updated pull request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize+1))
+	if err != nil {
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxPayloadSize {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !s.validSignature(body, r.Header.Get("X-Hub-Signature")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	jobs, err := parseJobs(r.Header.Get("X-Event-Key"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Queue all of the delivery's jobs or none of them, so that Bitbucket's
+	// redelivery after a 503 does not scan some refs twice
+	s.queueMu.Lock()
+	if cap(s.queue)-len(s.queue) < len(jobs) {
+		s.queueMu.Unlock()
+		http.Error(w, "scan queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	for _, job := range jobs {
+		s.queue <- job
+	}
+	s.queueMu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "queued %d scans\n", len(jobs))
+}
+
+// validSignature checks an X-Hub-Signature header of the form "sha256=<hex HMAC of body>"
+func (s *Server) validSignature(body []byte, header string) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// parseJobs turns a webhook payload into the scans it requires. Events other
+// than pushes and opened or updated pull requests, including Bitbucket's
+// test ping, produce no jobs.
+func parseJobs(event string, body []byte) ([]Job, error) {
+	var jobs []Job
+
+	switch event {
+	case "repo:refs_changed":
+		var payload refsChangedPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid %s payload: %v", event, err)
+		}
+		for _, change := range payload.Changes {
+			if change.Type == "DELETE" || change.ToHash == "" || change.ToHash == zeroHash {
+				continue
+			}
+			job := Job{
+				Event:          event,
+				ProjectKey:     payload.Repository.Project.Key,
+				RepositorySlug: payload.Repository.Slug,
+				Ref:            change.Ref.ID,
+				CommitID:       change.ToHash,
+			}
+			if change.FromHash != zeroHash {
+				job.FromCommitID = change.FromHash
+			}
+			jobs = append(jobs, job)
+		}
+
+	case "pr:opened", "pr:from_ref_updated":
+		var payload pullRequestPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid %s payload: %v", event, err)
+		}
+		repo := payload.PullRequest.ToRef.Repository
+		jobs = append(jobs, Job{
+			Event:          event,
+			ProjectKey:     repo.Project.Key,
+			RepositorySlug: repo.Slug,
+			Ref:            payload.PullRequest.ToRef.ID,
+			PullRequestID:  payload.PullRequest.ID,
+		})
+	}
+
+	for _, job := range jobs {
+		if job.ProjectKey == "" || job.RepositorySlug == "" {
+			return nil, fmt.Errorf("%s payload does not identify the repository", event)
+		}
+	}
+	return jobs, nil
+}
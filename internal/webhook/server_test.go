@@ -0,0 +1,229 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/internal/scanner"
+	"bitbucket-secrets-scanner/pkg/bbtest"
+)
+
+const testSecret = "webhook-secret"
+
+// result is a scan reported to the ResultHandler
+type result struct {
+	job   Job
+	files []string
+	err   error
+}
+
+// testServer is a webhook server backed by a fake Bitbucket server. Its jobs
+// are processed by the test rather than by background workers.
+type testServer struct {
+	*Server
+	bitbucket *bbtest.Server
+	repo      *bbtest.Repository
+	results   []result
+}
+
+func newTestServer(t *testing.T, queueSize int) *testServer {
+	t.Helper()
+	srv := bbtest.NewServer()
+	t.Cleanup(srv.Close)
+	client, err := bitbucket.NewClient(srv.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	detector := scanner.NewSecretDetector()
+
+	ts := &testServer{bitbucket: srv, repo: srv.AddRepository("PRJ", "app")}
+	newScanner := func() *scanner.BitbucketScanner {
+		return scanner.NewBitbucketScanner(client, detector)
+	}
+	ts.Server = NewServer(testSecret, newScanner, queueSize, func(job Job, secrets []scanner.Secret, err error) {
+		var files []string
+		for _, secret := range secrets {
+			files = append(files, secret.Filename)
+		}
+		sort.Strings(files)
+		ts.results = append(ts.results, result{job: job, files: files, err: err})
+	})
+	return ts
+}
+
+// sign returns the X-Hub-Signature of body
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver sends a webhook and returns the response status
+func (ts *testServer) deliver(event, body, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("X-Event-Key", event)
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	ts.ServeHTTP(w, req)
+	return w.Code
+}
+
+// processQueued runs every queued job
+func (ts *testServer) processQueued() {
+	for len(ts.queue) > 0 {
+		ts.process(context.Background(), <-ts.queue)
+	}
+}
+
+// refsChanged returns a repo:refs_changed payload
+func refsChanged(ref, fromHash, toHash, changeType string) string {
+	return fmt.Sprintf(`{"repository":{"slug":"app","project":{"key":"PRJ"}},"changes":[`+
+		`{"ref":{"id":%q,"type":"BRANCH"},"fromHash":%q,"toHash":%q,"type":%q}]}`, ref, fromHash, toHash, changeType)
+}
+
+// secretFile returns a file with a secret
+func secretFile(value string) string {
+	return fmt.Sprintf("password = %q\n", value)
+}
+
+func TestSignature(t *testing.T) {
+	ts := newTestServer(t, 10)
+	body := refsChanged("refs/heads/main", zeroHash, strings.Repeat("a", 40), "ADD")
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"missing", ""},
+		{"wrong secret", sign("other", body)},
+		{"not hex", "sha256=zz"},
+		{"no algorithm", strings.TrimPrefix(sign(testSecret, body), "sha256=")},
+	}
+	for _, tt := range tests {
+		if got := ts.deliver("repo:refs_changed", body, tt.signature); got != http.StatusUnauthorized {
+			t.Errorf("%s signature: got status %d, want 401", tt.name, got)
+		}
+	}
+	if len(ts.queue) != 0 {
+		t.Errorf("queued %d jobs for unsigned deliveries", len(ts.queue))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/webhook", nil)
+	w := httptest.NewRecorder()
+	ts.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, want 405", w.Code)
+	}
+
+	invalid := `{"changes": [`
+	if got := ts.deliver("repo:refs_changed", invalid, sign(testSecret, invalid)); got != http.StatusBadRequest {
+		t.Errorf("invalid payload: got status %d, want 400", got)
+	}
+}
+
+func TestRefsChanged(t *testing.T) {
+	ts := newTestServer(t, 10)
+	first := ts.repo.Commit("main", bbtest.Change{Message: "First", Files: map[string]string{"a.txt": secretFile("h7Jk2pQz9Lx4Vb8N")}})
+	second := ts.repo.Commit("main", bbtest.Change{Message: "Second", Files: map[string]string{"b.txt": secretFile("Zp4Lk9Qx2Vb7Nm3R")}})
+	ts.repo.Branch("feature", second)
+	feature := ts.repo.Commit("feature", bbtest.Change{Message: "Feature", Files: map[string]string{"c.txt": secretFile("Wq8Rt5Yu2Io9Pa4S")}})
+
+	tests := []struct {
+		name  string
+		body  string
+		files []string // nil when no scan is queued
+	}{
+		{"update scans only the pushed commits", refsChanged("refs/heads/main", first, second, "UPDATE"), []string{"b.txt"}},
+		{"add scans the commits not on the default branch", refsChanged("refs/heads/feature", zeroHash, feature, "ADD"), []string{"c.txt"}},
+		{"delete does not scan", refsChanged("refs/heads/feature", feature, zeroHash, "DELETE"), nil},
+	}
+	for _, tt := range tests {
+		ts.results = nil
+		if got := ts.deliver("repo:refs_changed", tt.body, sign(testSecret, tt.body)); got != http.StatusAccepted {
+			t.Errorf("%s: got status %d, want 202", tt.name, got)
+			continue
+		}
+		ts.processQueued()
+
+		if tt.files == nil {
+			if len(ts.results) != 0 {
+				t.Errorf("%s: got scans %+v, want none", tt.name, ts.results)
+			}
+			continue
+		}
+		if len(ts.results) != 1 {
+			t.Errorf("%s: got %d scans, want 1", tt.name, len(ts.results))
+			continue
+		}
+		if got := ts.results[0]; got.err != nil || !reflect.DeepEqual(got.files, tt.files) {
+			t.Errorf("%s: got secrets in %v (error %v), want %v", tt.name, got.files, got.err, tt.files)
+		}
+	}
+}
+
+func TestPullRequestEvents(t *testing.T) {
+	ts := newTestServer(t, 10)
+	base := ts.repo.Commit("main", bbtest.Change{Message: "Base", Files: map[string]string{"README.md": "# App\n"}})
+	ts.repo.Branch("feature", base)
+	ts.repo.Commit("feature", bbtest.Change{Message: "Config", Files: map[string]string{"config.yml": secretFile("h7Jk2pQz9Lx4Vb8N")}})
+	id := ts.repo.PullRequest("Add config", "feature", "main")
+
+	body := fmt.Sprintf(`{"pullRequest":{"id":%d,"toRef":{"id":"refs/heads/main",`+
+		`"repository":{"slug":"app","project":{"key":"PRJ"}}}}}`, id)
+	for _, event := range []string{"pr:opened", "pr:from_ref_updated"} {
+		ts.results = nil
+		if got := ts.deliver(event, body, sign(testSecret, body)); got != http.StatusAccepted {
+			t.Errorf("%s: got status %d, want 202", event, got)
+			continue
+		}
+		ts.processQueued()
+
+		if len(ts.results) != 1 || ts.results[0].job.PullRequestID != id || !reflect.DeepEqual(ts.results[0].files, []string{"config.yml"}) {
+			t.Errorf("%s: got scans %+v, want one of pull request %d finding config.yml", event, ts.results, id)
+		}
+	}
+	if comments := ts.repo.Comments(id); len(comments) == 0 {
+		t.Error("no comments were posted on the pull request")
+	}
+
+	ping := `{"test": true}`
+	ts.results = nil
+	if got := ts.deliver("diagnostics:ping", ping, sign(testSecret, ping)); got != http.StatusAccepted || len(ts.queue) != 0 {
+		t.Errorf("ping: got status %d with %d queued jobs, want 202 with none", got, len(ts.queue))
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	ts := newTestServer(t, 1)
+
+	// Two changes do not fit in a queue of one, so neither is queued
+	body := `{"repository":{"slug":"app","project":{"key":"PRJ"}},"changes":[` +
+		`{"ref":{"id":"refs/heads/a"},"fromHash":"` + zeroHash + `","toHash":"` + strings.Repeat("a", 40) + `","type":"ADD"},` +
+		`{"ref":{"id":"refs/heads/b"},"fromHash":"` + zeroHash + `","toHash":"` + strings.Repeat("b", 40) + `","type":"ADD"}]}`
+	if got := ts.deliver("repo:refs_changed", body, sign(testSecret, body)); got != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", got)
+	}
+	if len(ts.queue) != 0 {
+		t.Errorf("queued %d jobs of a rejected delivery, want 0", len(ts.queue))
+	}
+
+	one := refsChanged("refs/heads/a", zeroHash, strings.Repeat("a", 40), "ADD")
+	if got := ts.deliver("repo:refs_changed", one, sign(testSecret, one)); got != http.StatusAccepted {
+		t.Errorf("got status %d, want 202", got)
+	}
+	if got := ts.deliver("repo:refs_changed", one, sign(testSecret, one)); got != http.StatusServiceUnavailable {
+		t.Errorf("full queue: got status %d, want 503", got)
+	}
+}
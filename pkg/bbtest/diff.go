@@ -0,0 +1,212 @@
+package bbtest
+
+import (
+	"sort"
+	"strings"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/pkg/util"
+)
+
+// maxDiffCells bounds the work of matching two versions of a file. Larger
+// files are diffed as if every line changed.
+const maxDiffCells = 4_000_000
+
+// splitLines splits file content into lines without their line endings
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// matchLines finds the longest common subsequence of two versions of a file.
+// It returns, for each new line, the index of the old line it is unchanged
+// from, or -1 when the line was added.
+func matchLines(oldLines, newLines []string) []int {
+	match := make([]int, len(newLines))
+	for i := range match {
+		match[i] = -1
+	}
+	n, m := len(oldLines), len(newLines)
+	if n == 0 || m == 0 || n*m > maxDiffCells {
+		return match
+	}
+
+	// lcs[i][j] is the length of the common subsequence of oldLines[i:] and newLines[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case oldLines[i] == newLines[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case oldLines[i] == newLines[j]:
+			match[j] = i
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+// fileDiff describes how a file changed, in the shape of a Bitbucket diff.
+// When context is set, each hunk starts with the unchanged line before it.
+// A missing side is passed as exists = false.
+func fileDiff(path, oldContent string, oldExists bool, newContent string, newExists bool, context bool) bitbucket.Diff {
+	var diff bitbucket.Diff
+	if oldExists {
+		diff.Source = &bitbucket.DiffPath{ToString: path}
+	}
+	if newExists {
+		diff.Destination = &bitbucket.DiffPath{ToString: path}
+	}
+	if util.IsBinary([]byte(oldContent)) || util.IsBinary([]byte(newContent)) {
+		diff.Binary = true
+		return diff
+	}
+
+	oldLines, newLines := splitLines(oldContent), splitLines(newContent)
+	match := matchLines(oldLines, newLines)
+	oldMatched := make([]bool, len(oldLines))
+	for _, i := range match {
+		if i >= 0 {
+			oldMatched[i] = true
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldLines) || j < len(newLines) {
+		if i < len(oldLines) && j < len(newLines) && match[j] == i {
+			i++
+			j++
+			continue
+		}
+
+		hunk := bitbucket.Hunk{SourceLine: i + 1, DestinationLine: j + 1}
+		if context && i > 0 && j > 0 {
+			hunk.SourceLine--
+			hunk.DestinationLine--
+			hunk.SourceSpan++
+			hunk.DestinationSpan++
+			hunk.Segments = append(hunk.Segments, bitbucket.Segment{
+				Type:  "CONTEXT",
+				Lines: []bitbucket.DiffLine{{Source: i, Destination: j, Line: newLines[j-1]}},
+			})
+		}
+		var removed, added []bitbucket.DiffLine
+		for i < len(oldLines) && !oldMatched[i] {
+			removed = append(removed, bitbucket.DiffLine{Source: i + 1, Destination: j + 1, Line: oldLines[i]})
+			i++
+		}
+		for j < len(newLines) && match[j] == -1 {
+			added = append(added, bitbucket.DiffLine{Source: i + 1, Destination: j + 1, Line: newLines[j]})
+			j++
+		}
+		hunk.SourceSpan += len(removed)
+		hunk.DestinationSpan += len(added)
+		if len(removed) > 0 {
+			hunk.Segments = append(hunk.Segments, bitbucket.Segment{Type: "REMOVED", Lines: removed})
+		}
+		if len(added) > 0 {
+			hunk.Segments = append(hunk.Segments, bitbucket.Segment{Type: "ADDED", Lines: added})
+		}
+		diff.Hunks = append(diff.Hunks, hunk)
+	}
+
+	return diff
+}
+
+// diffTrees describes every file that differs between two commits. A nil
+// from compares against an empty tree.
+func diffTrees(from, to *commit, context bool) []bitbucket.Diff {
+	paths := make(map[string]bool)
+	var fromFiles map[string]string
+	if from != nil {
+		fromFiles = from.files
+	}
+	for path := range fromFiles {
+		paths[path] = true
+	}
+	for path := range to.files {
+		paths[path] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var diffs []bitbucket.Diff
+	for _, path := range sorted {
+		oldContent, oldExists := fromFiles[path]
+		newContent, newExists := to.files[path]
+		if oldExists && newExists && oldContent == newContent {
+			continue
+		}
+		diffs = append(diffs, fileDiff(path, oldContent, oldExists, newContent, newExists, context))
+	}
+	return diffs
+}
+
+// blame finds the commit that last changed each line of a file, following
+// first parents
+func (r *Repository) blame(head *commit, path string) []*commit {
+	lines := splitLines(head.files[path])
+	owners := make([]*commit, len(lines))
+	positions := make([]int, len(lines))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	current := head
+	for {
+		var parent *commit
+		if len(current.parents) > 0 {
+			parent = r.commits[current.parents[0]]
+		}
+		parentContent, inParent := "", false
+		if parent != nil {
+			parentContent, inParent = parent.files[path]
+		}
+
+		// Lines not unchanged from the parent were last changed here
+		var match []int
+		if inParent {
+			match = matchLines(splitLines(parentContent), splitLines(current.files[path]))
+		}
+		remaining := 0
+		for i := range lines {
+			if owners[i] != nil {
+				continue
+			}
+			if !inParent || match[positions[i]] < 0 {
+				owners[i] = current
+				continue
+			}
+			positions[i] = match[positions[i]]
+			remaining++
+		}
+		if remaining == 0 {
+			return owners
+		}
+		current = parent
+	}
+}
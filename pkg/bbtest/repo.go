@@ -0,0 +1,295 @@
+package bbtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+)
+
+// epoch is the date of the first fixture commit; later commits are a minute apart
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Change describes a commit to add to a repository
+type Change struct {
+	Message     string
+	AuthorName  string
+	AuthorEmail string
+	Files       map[string]string // Contents of files added or modified, by path
+	Deleted     []string          // Paths of files removed
+}
+
+// commit is a commit of a fixture repository with its full tree
+type commit struct {
+	id          string
+	message     string
+	authorName  string
+	authorEmail string
+	date        time.Time
+	parents     []string
+	files       map[string]string
+}
+
+// pullRequest is an open pull request of a fixture repository
+type pullRequest struct {
+	id         int
+	title      string
+	fromBranch string
+	toBranch   string
+	comments   []bitbucket.Comment
+}
+
+// Repository is a fixture repository served by a Server. Its methods may be
+// called while the server is running.
+type Repository struct {
+	server        *Server
+	projectKey    string
+	slug          string
+	defaultBranch string
+	commits       map[string]*commit
+	branches      map[string]string // Head commit by branch name
+	tags          map[string]string // Commit by tag name
+	pullRequests  map[int]*pullRequest
+}
+
+// AddRepository adds an empty repository whose default branch is "main"
+func (s *Server) AddRepository(projectKey, slug string) *Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := &Repository{
+		server:        s,
+		projectKey:    projectKey,
+		slug:          slug,
+		defaultBranch: "main",
+		commits:       make(map[string]*commit),
+		branches:      make(map[string]string),
+		tags:          make(map[string]string),
+		pullRequests:  make(map[int]*pullRequest),
+	}
+	s.repos[projectKey+"/"+slug] = repo
+	return repo
+}
+
+// AddDirectory adds a repository with a single commit on "main" whose tree
+// holds every regular file under dir
+func (s *Server) AddDirectory(projectKey, slug, dir string) (*Repository, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repo := s.AddRepository(projectKey, slug)
+	repo.Commit("main", Change{Message: "Import " + filepath.Base(dir), Files: files})
+	return repo, nil
+}
+
+// Commit adds a commit to the head of branch, creating the branch if it does
+// not exist, and returns the new commit ID
+func (r *Repository) Commit(branch string, change Change) string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	var parents []string
+	if head, ok := r.branches[branch]; ok {
+		parents = []string{head}
+	}
+	return r.addCommit(branch, parents, change)
+}
+
+// Merge adds a commit merging the head of from into branch and returns the
+// new commit ID. The merged tree has the files of both heads, those of from
+// taking precedence, with change applied on top.
+func (r *Repository) Merge(branch, from string, change Change) string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	return r.addCommit(branch, []string{r.branches[branch], r.branches[from]}, change)
+}
+
+// addCommit adds a commit with the given parents to the head of branch. Its
+// tree has the files of the parents, later parents taking precedence, with
+// change applied on top.
+func (r *Repository) addCommit(branch string, parents []string, change Change) string {
+	files := make(map[string]string)
+	for _, parent := range parents {
+		for path, content := range r.commits[parent].files {
+			files[path] = content
+		}
+	}
+	for path, content := range change.Files {
+		files[path] = content
+	}
+	for _, path := range change.Deleted {
+		delete(files, path)
+	}
+
+	c := &commit{
+		message:     change.Message,
+		authorName:  change.AuthorName,
+		authorEmail: change.AuthorEmail,
+		date:        epoch.Add(time.Duration(len(r.server.allCommits)) * time.Minute),
+		parents:     parents,
+		files:       files,
+	}
+	if c.authorName == "" {
+		c.authorName = "Fixture Author"
+		c.authorEmail = "author@example.com"
+	}
+	c.id = commitID(c)
+
+	r.commits[c.id] = c
+	r.branches[branch] = c.id
+	r.server.allCommits = append(r.server.allCommits, c.id)
+	return c.id
+}
+
+// Branch points a branch at a commit
+func (r *Repository) Branch(name, commitID string) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.branches[name] = commitID
+}
+
+// Tag points a tag at a commit
+func (r *Repository) Tag(name, commitID string) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.tags[name] = commitID
+}
+
+// SetDefaultBranch changes the default branch
+func (r *Repository) SetDefaultBranch(name string) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.defaultBranch = name
+}
+
+// PullRequest opens a pull request from one branch to another and returns its ID
+func (r *Repository) PullRequest(title, fromBranch, toBranch string) int {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	id := len(r.pullRequests) + 1
+	r.pullRequests[id] = &pullRequest{
+		id:         id,
+		title:      title,
+		fromBranch: fromBranch,
+		toBranch:   toBranch,
+	}
+	return id
+}
+
+// Comments returns the comments posted on a pull request
+func (r *Repository) Comments(pullRequestID int) []bitbucket.Comment {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+
+	pr, ok := r.pullRequests[pullRequestID]
+	if !ok {
+		return nil
+	}
+	return append([]bitbucket.Comment(nil), pr.comments...)
+}
+
+// resolve finds the commit a revision names: a commit ID, a branch or tag
+// name or ref, or a pull request ref
+func (r *Repository) resolve(rev string) (*commit, bool) {
+	if c, ok := r.commits[rev]; ok {
+		return c, true
+	}
+	if len(rev) >= 4 {
+		for id, c := range r.commits {
+			if strings.HasPrefix(id, rev) {
+				return c, true
+			}
+		}
+	}
+
+	name := strings.TrimPrefix(rev, "refs/heads/")
+	if id, ok := r.branches[name]; ok {
+		return r.commits[id], true
+	}
+	name = strings.TrimPrefix(rev, "refs/tags/")
+	if id, ok := r.tags[name]; ok {
+		return r.commits[id], true
+	}
+
+	var id int
+	var side string
+	if _, err := fmt.Sscanf(rev, "refs/pull-requests/%d/%s", &id, &side); err == nil {
+		if pr, ok := r.pullRequests[id]; ok && side == "from" {
+			return r.resolve(pr.fromBranch)
+		}
+	}
+	return nil, false
+}
+
+// reachable returns every commit reachable from head, newest first
+func (r *Repository) reachable(head *commit) []*commit {
+	seen := map[string]bool{head.id: true}
+	pending := []*commit{head}
+	var commits []*commit
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		commits = append(commits, c)
+		for _, parent := range c.parents {
+			if !seen[parent] {
+				seen[parent] = true
+				pending = append(pending, r.commits[parent])
+			}
+		}
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].date.After(commits[j].date)
+	})
+	return commits
+}
+
+// paths returns the paths of a commit's files in order
+func (c *commit) paths() []string {
+	paths := make([]string, 0, len(c.files))
+	for path := range c.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// commitID derives a stable commit ID from a commit's contents
+func commitID(c *commit) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%d\x00%v\n", c.message, c.authorName, c.authorEmail, c.date.Unix(), c.parents)
+	for _, path := range c.paths() {
+		fmt.Fprintf(hash, "%s\x00%s\x00", path, c.files[path])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
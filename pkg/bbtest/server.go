@@ -0,0 +1,612 @@
+// Package bbtest provides a fake Bitbucket Data Center server for running
+// scans end to end without a real Bitbucket instance. It serves the REST
+// endpoints used by the bitbucket package from in-memory fixture
+// repositories, and can fail requests on demand to exercise retries.
+//
+// The package is for this module's own tests. Reports, comments and build
+// statuses are returned as types of the internal bitbucket package, which
+// other modules cannot import, and the API may change without notice.
+//
+// A typical test adds a repository, commits fixture files and points a
+// client at the server:
+//
+//	srv := bbtest.NewServer()
+//	defer srv.Close()
+//	repo := srv.AddRepository("PRJ", "app")
+//	commitID := repo.Commit("main", bbtest.Change{
+//		Message: "Add config",
+//		Files:   map[string]string{"config.yml": "password: hunter2hunter2"},
+//	})
+//	client, _ := bitbucket.NewClient(srv.URL, "token")
+package bbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bitbucket-secrets-scanner/internal/bitbucket"
+	"bitbucket-secrets-scanner/pkg/util"
+)
+
+// DefaultPageLimit is the largest page the server returns unless changed with
+// SetPageLimit. It is small so that clients have to follow pagination.
+const DefaultPageLimit = 25
+
+// Failure describes requests the server fails instead of serving
+type Failure struct {
+	Path       string // Fail only requests whose path contains Path; empty matches every request
+	Status     int    // Status code to respond with, such as 429 or 503
+	Count      int    // Number of requests to fail
+	RetryAfter string // Value of the Retry-After header, if any
+}
+
+// Server is a fake Bitbucket Data Center server. It embeds the underlying
+// httptest.Server, whose URL is the base URL to give a client.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	repos         map[string]*Repository // By "PROJECT/slug"
+	allCommits    []string
+	token         string
+	pageLimit     int
+	failures      []*Failure
+	requests      []string
+	reports       map[string]bitbucket.InsightReport
+	annotations   map[string][]bitbucket.InsightAnnotation
+	buildStatuses map[string][]bitbucket.BuildStatus
+}
+
+// NewServer starts a server with no repositories. The caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		repos:         make(map[string]*Repository),
+		pageLimit:     DefaultPageLimit,
+		reports:       make(map[string]bitbucket.InsightReport),
+		annotations:   make(map[string][]bitbucket.InsightAnnotation),
+		buildStatuses: make(map[string][]bitbucket.BuildStatus),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// RequireToken makes the server reject requests that do not send token as a
+// bearer token. By default any credentials are accepted.
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetPageLimit changes the largest page the server returns
+func (s *Server) SetPageLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageLimit = limit
+}
+
+// Fail makes the server fail the next f.Count requests that match f.Path
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// Requests returns every request received, as "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Report returns the Code Insights report and annotations published on a commit
+func (s *Server) Report(projectKey, repoSlug, commitID, reportKey string) (bitbucket.InsightReport, []bitbucket.InsightAnnotation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.Join([]string{projectKey, repoSlug, commitID, reportKey}, "/")
+	report, ok := s.reports[key]
+	return report, append([]bitbucket.InsightAnnotation(nil), s.annotations[key]...), ok
+}
+
+// BuildStatuses returns the build statuses set on a commit, oldest first
+func (s *Server) BuildStatuses(commitID string) []bitbucket.BuildStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bitbucket.BuildStatus(nil), s.buildStatuses[commitID]...)
+}
+
+// serveHTTP records the request, applies any injected failure and routes it
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+
+	for _, f := range s.failures {
+		if f.Count > 0 && strings.Contains(r.URL.Path, f.Path) {
+			f.Count--
+			if f.RetryAfter != "" {
+				w.Header().Set("Retry-After", f.RetryAfter)
+			}
+			writeError(w, f.Status, "injected failure")
+			return
+		}
+	}
+
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeError(w, http.StatusUnauthorized, "Authentication failed. Please check your credentials and try again.")
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/rest/api/1.0/projects"):
+		s.serveAPI(w, r, splitPath(strings.TrimPrefix(path, "/rest/api/1.0/projects")))
+	case strings.HasPrefix(path, "/rest/insights/1.0/projects/"):
+		s.serveInsights(w, r, splitPath(strings.TrimPrefix(path, "/rest/insights/1.0/projects/")))
+	case strings.HasPrefix(path, "/rest/build-status/1.0/commits/") && r.Method == http.MethodPost:
+		var status bitbucket.BuildStatus
+		if !readJSON(w, r, &status) {
+			return
+		}
+		commitID := strings.TrimPrefix(path, "/rest/build-status/1.0/commits/")
+		s.buildStatuses[commitID] = append(s.buildStatuses[commitID], status)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// serveAPI serves the core REST API under /rest/api/1.0/projects
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) == 0 {
+		var values []interface{}
+		seen := make(map[string]bool)
+		for _, key := range s.sortedRepoKeys() {
+			repo := s.repos[key]
+			if !seen[repo.projectKey] {
+				seen[repo.projectKey] = true
+				values = append(values, map[string]string{"key": repo.projectKey, "name": repo.projectKey})
+			}
+		}
+		s.writePage(w, r, values)
+		return
+	}
+
+	if len(segments) == 2 && segments[1] == "repos" {
+		var values []interface{}
+		for _, key := range s.sortedRepoKeys() {
+			repo := s.repos[key]
+			if repo.projectKey == segments[0] {
+				values = append(values, repoJSON(repo))
+			}
+		}
+		s.writePage(w, r, values)
+		return
+	}
+
+	if len(segments) < 4 || segments[1] != "repos" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	repo, ok := s.repos[segments[0]+"/"+segments[2]]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Repository %s/%s does not exist.", segments[0], segments[2]))
+		return
+	}
+
+	s.serveRepository(w, r, repo, segments[3], segments[4:])
+}
+
+// serveRepository serves the endpoints of a single repository
+func (s *Server) serveRepository(w http.ResponseWriter, r *http.Request, repo *Repository, resource string, rest []string) {
+	query := r.URL.Query()
+
+	switch {
+	case resource == "branches" && len(rest) == 1 && rest[0] == "default":
+		head, ok := repo.branches[repo.defaultBranch]
+		if !ok {
+			writeError(w, http.StatusNotFound, "The repository is empty.")
+			return
+		}
+		writeJSON(w, branchJSON(repo, repo.defaultBranch, head))
+
+	case resource == "branches" && len(rest) == 0:
+		filter := query.Get("filterText")
+		var values []interface{}
+		for _, name := range sortedKeys(repo.branches) {
+			if strings.Contains(name, filter) {
+				values = append(values, branchJSON(repo, name, repo.branches[name]))
+			}
+		}
+		s.writePage(w, r, values)
+
+	case resource == "tags" && len(rest) == 0:
+		var values []interface{}
+		for _, name := range sortedKeys(repo.tags) {
+			values = append(values, tagJSON(name, repo.tags[name]))
+		}
+		s.writePage(w, r, values)
+
+	case resource == "tags":
+		name := strings.Join(rest, "/")
+		id, ok := repo.tags[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Tag %s does not exist.", name))
+			return
+		}
+		writeJSON(w, tagJSON(name, id))
+
+	case resource == "commits" && len(rest) == 0:
+		until, ok := repo.resolve(query.Get("until"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Commit %s does not exist.", query.Get("until")))
+			return
+		}
+		excluded := make(map[string]bool)
+		if since := query.Get("since"); since != "" {
+			from, ok := repo.resolve(since)
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("Commit %s does not exist.", since))
+				return
+			}
+			for _, c := range repo.reachable(from) {
+				excluded[c.id] = true
+			}
+		}
+		var values []interface{}
+		for _, c := range repo.reachable(until) {
+			if !excluded[c.id] {
+				values = append(values, commitJSON(c))
+			}
+		}
+		s.writePage(w, r, values)
+
+	case resource == "commits" && len(rest) > 1 && rest[len(rest)-1] == "diff":
+		c, ok := repo.resolve(strings.Join(rest[:len(rest)-1], "/"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "Commit does not exist.")
+			return
+		}
+		var from *commit
+		if len(c.parents) > 0 {
+			from = repo.commits[c.parents[0]]
+		}
+		if since := query.Get("since"); since != "" {
+			if from, ok = repo.resolve(since); !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("Commit %s does not exist.", since))
+				return
+			}
+		}
+		writeJSON(w, map[string]interface{}{"diffs": diffTrees(from, c, hasContext(r))})
+
+	case resource == "commits":
+		c, ok := repo.resolve(strings.Join(rest, "/"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Commit %s does not exist.", strings.Join(rest, "/")))
+			return
+		}
+		writeJSON(w, commitJSON(c))
+
+	case resource == "files":
+		c, ok := repo.resolveAt(query.Get("at"))
+		if !ok {
+			writeError(w, http.StatusNotFound, "Commit does not exist.")
+			return
+		}
+		var values []interface{}
+		for _, path := range c.paths() {
+			values = append(values, path)
+		}
+		s.writePage(w, r, values)
+
+	case resource == "raw":
+		c, ok := repo.resolveAt(query.Get("at"))
+		path := strings.Join(rest, "/")
+		content, exists := "", false
+		if ok {
+			content, exists = c.files[path]
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("The path \"%s\" does not exist at revision \"%s\"", path, query.Get("at")))
+			return
+		}
+		if util.IsBinary([]byte(content)) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write([]byte(content))
+
+	case resource == "browse" && query.Get("blame") == "true":
+		c, ok := repo.resolveAt(query.Get("at"))
+		path := strings.Join(rest, "/")
+		if ok {
+			_, ok = c.files[path]
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("The path \"%s\" does not exist", path))
+			return
+		}
+		writeJSON(w, blameJSON(repo.blame(c, path), path))
+
+	case resource == "pull-requests" && len(rest) >= 1:
+		id, err := strconv.Atoi(rest[0])
+		pr, ok := repo.pullRequests[id]
+		if err != nil || !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Pull request %s does not exist.", rest[0]))
+			return
+		}
+		s.servePullRequest(w, r, repo, pr, rest[1:])
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// servePullRequest serves a pull request, its diff and its comments
+func (s *Server) servePullRequest(w http.ResponseWriter, r *http.Request, repo *Repository, pr *pullRequest, rest []string) {
+	from, fromOK := repo.resolve(pr.fromBranch)
+	to, toOK := repo.resolve(pr.toBranch)
+	if !fromOK || !toOK {
+		writeError(w, http.StatusNotFound, "Pull request branch does not exist.")
+		return
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, bitbucket.PullRequest{
+			ID:      pr.id,
+			Title:   pr.title,
+			State:   "OPEN",
+			FromRef: bitbucket.Ref{ID: "refs/heads/" + pr.fromBranch, DisplayID: pr.fromBranch, LatestCommit: from.id},
+			ToRef:   bitbucket.Ref{ID: "refs/heads/" + pr.toBranch, DisplayID: pr.toBranch, LatestCommit: to.id},
+		})
+
+	case len(rest) == 1 && rest[0] == "diff" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{"diffs": diffTrees(to, from, hasContext(r))})
+
+	case len(rest) == 1 && rest[0] == "comments" && r.Method == http.MethodGet:
+		path := r.URL.Query().Get("path")
+		if path == "" {
+			writeError(w, http.StatusBadRequest, "The path query parameter is required.")
+			return
+		}
+		var values []interface{}
+		for _, comment := range pr.comments {
+			if comment.Anchor != nil && comment.Anchor.Path == path {
+				values = append(values, comment)
+			}
+		}
+		s.writePage(w, r, values)
+
+	case len(rest) == 1 && rest[0] == "comments" && r.Method == http.MethodPost:
+		var comment bitbucket.Comment
+		if !readJSON(w, r, &comment) {
+			return
+		}
+		comment.ID = len(pr.comments) + 1
+		pr.comments = append(pr.comments, comment)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, comment)
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// serveInsights records Code Insights reports and annotations
+func (s *Server) serveInsights(w http.ResponseWriter, r *http.Request, segments []string) {
+	// {project}/repos/{repo}/commits/{commit}/reports/{key}[/annotations]
+	if len(segments) < 7 || segments[1] != "repos" || segments[3] != "commits" || segments[5] != "reports" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	key := strings.Join([]string{segments[0], segments[2], segments[4], segments[6]}, "/")
+	annotations := len(segments) == 8 && segments[7] == "annotations"
+
+	switch {
+	case len(segments) == 7 && r.Method == http.MethodPut:
+		var report bitbucket.InsightReport
+		if !readJSON(w, r, &report) {
+			return
+		}
+		s.reports[key] = report
+		writeJSON(w, report)
+	case annotations && r.Method == http.MethodDelete:
+		delete(s.annotations, key)
+		w.WriteHeader(http.StatusNoContent)
+	case annotations && r.Method == http.MethodPost:
+		var body struct {
+			Annotations []bitbucket.InsightAnnotation `json:"annotations"`
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+		if _, ok := s.reports[key]; !ok {
+			writeError(w, http.StatusNotFound, "Report does not exist.")
+			return
+		}
+		s.annotations[key] = append(s.annotations[key], body.Annotations...)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// resolveAt resolves the "at" parameter of a file request, which defaults to
+// the default branch
+func (r *Repository) resolveAt(at string) (*commit, bool) {
+	if at == "" {
+		at = r.defaultBranch
+	}
+	return r.resolve(at)
+}
+
+// hasContext reports whether a diff request asks for context lines
+func hasContext(r *http.Request) bool {
+	lines, err := strconv.Atoi(r.URL.Query().Get("contextLines"))
+	return err == nil && lines > 0
+}
+
+// writePage writes one page of values, honouring the start and limit parameters
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, values []interface{}) {
+	start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > s.pageLimit {
+		limit = s.pageLimit
+	}
+	if start < 0 || start > len(values) {
+		start = len(values)
+	}
+	end := start + limit
+	if end > len(values) {
+		end = len(values)
+	}
+
+	page := map[string]interface{}{
+		"size":       end - start,
+		"limit":      limit,
+		"start":      start,
+		"isLastPage": end == len(values),
+		"values":     append([]interface{}{}, values[start:end]...),
+	}
+	if end < len(values) {
+		page["nextPageStart"] = end
+	}
+	writeJSON(w, page)
+}
+
+// sortedRepoKeys returns the repository keys in order
+func (s *Server) sortedRepoKeys() []string {
+	keys := make(map[string]string, len(s.repos))
+	for key := range s.repos {
+		keys[key] = key
+	}
+	return sortedKeys(keys)
+}
+
+// repoJSON encodes a repository as the REST API does
+func repoJSON(repo *Repository) map[string]interface{} {
+	return map[string]interface{}{
+		"slug":    repo.slug,
+		"name":    repo.slug,
+		"project": map[string]string{"key": repo.projectKey, "name": repo.projectKey},
+	}
+}
+
+// branchJSON encodes a branch as the REST API does
+func branchJSON(repo *Repository, name, commitID string) bitbucket.Branch {
+	return bitbucket.Branch{
+		ID:           "refs/heads/" + name,
+		DisplayID:    name,
+		LatestCommit: commitID,
+		IsDefault:    name == repo.defaultBranch,
+	}
+}
+
+// tagJSON encodes a lightweight tag as the REST API does
+func tagJSON(name, commitID string) bitbucket.Tag {
+	return bitbucket.Tag{
+		ID:           "refs/tags/" + name,
+		DisplayID:    name,
+		LatestCommit: commitID,
+		Hash:         commitID,
+	}
+}
+
+// commitJSON encodes a commit as the REST API does, with the author date in
+// milliseconds since the epoch
+func commitJSON(c *commit) map[string]interface{} {
+	parents := make([]map[string]string, len(c.parents))
+	for i, parent := range c.parents {
+		parents[i] = map[string]string{"id": parent, "displayId": parent[:11]}
+	}
+	return map[string]interface{}{
+		"id":              c.id,
+		"displayId":       c.id[:11],
+		"author":          map[string]string{"name": c.authorName, "emailAddress": c.authorEmail},
+		"authorTimestamp": c.date.UnixMilli(),
+		"message":         c.message,
+		"parents":         parents,
+	}
+}
+
+// blameJSON groups consecutive lines last changed by the same commit, as the
+// browse API does with blame=true&noContent=true
+func blameJSON(owners []*commit, path string) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for i := 0; i < len(owners); {
+		j := i
+		for j < len(owners) && owners[j] == owners[i] {
+			j++
+		}
+		c := owners[i]
+		entries = append(entries, map[string]interface{}{
+			"author":            map[string]string{"name": c.authorName, "emailAddress": c.authorEmail},
+			"authorTimestamp":   c.date.UnixMilli(),
+			"commitHash":        c.id,
+			"displayCommitHash": c.id[:11],
+			"fileName":          path,
+			"lineNumber":        i + 1,
+			"spannedLines":      j - i,
+		})
+		i = j
+	}
+	return entries
+}
+
+// splitPath splits a URL path into its non-empty segments
+func splitPath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readJSON decodes a JSON request body, writing a 400 response if it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in the format of the REST API
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
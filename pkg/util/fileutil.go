@@ -1,10 +1,17 @@
 package util
 
 import (
+	"bytes"
+	"mime"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
 )
 
+// SniffLen is the number of leading bytes examined by IsBinary
+const SniffLen = 8000
+
 // ListFilesInDirectory returns a list of all files in a directory and its subdirectories
 func ListFilesInDirectory(dirPath string) ([]string, error) {
 	var files []string
@@ -27,3 +34,52 @@ func ListFilesInDirectory(dirPath string) ([]string, error) {
 
 	return files, nil
 }
+
+// IsBinary reports whether data, the leading bytes of a file, looks like
+// binary rather than text: it contains a NUL byte or is mostly not valid UTF-8
+func IsBinary(data []byte) bool {
+	if len(data) > SniffLen {
+		data = data[:SniffLen]
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+
+	total := len(data)
+	invalid := 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		// A multi-byte rune may be cut off at the end of the sample
+		if r == utf8.RuneError && size == 1 && len(data) >= utf8.UTFMax {
+			invalid++
+		}
+		data = data[size:]
+	}
+	return invalid*10 > total
+}
+
+// IsBinaryContentType reports whether a Content-Type header names a binary media type
+func IsBinaryContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-tar",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/java-archive",
+		"application/pdf", "application/x-executable", "application/x-sharedlib", "application/wasm":
+		return true
+	}
+	return false
+}